@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
-	"log"
 
 	"michiru/config"
 	"michiru/internal/clients"
+	"michiru/internal/logging"
 )
 
 func main() {
 	var cfg config.Config
 	if err := config.Load(&cfg); err != nil {
-		log.Fatalf("FATAL: Could not load configuration.\n%v", err)
+		logging.Fatal("Could not load configuration", err)
+	}
+	if err := logging.Setup(cfg); err != nil {
+		logging.Fatal("Could not set up logging", err)
+	}
+
+	backend, err := clients.NewBackend(cfg)
+	if err != nil {
+		logging.Fatal("Could not create search backend", err)
 	}
 
-	err := clients.ResetIndexes(context.Background(), cfg)
+	err = backend.Reset(context.Background())
 	if err != nil {
-		log.Fatalf("FATAL: Could not delete indexes.\n%v", err)
+		logging.Fatal("Could not delete indexes", err)
 	}
 }
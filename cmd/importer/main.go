@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os/signal"
 	"syscall"
 
 	"michiru/config"
 	"michiru/handlers"
 	"michiru/internal/clients"
+	"michiru/internal/logging"
+	"michiru/internal/metrics"
+	"michiru/internal/tracing"
+	"michiru/models"
 )
 
 func main() {
@@ -21,42 +25,42 @@ func main() {
 	// Load env
 	var cfg config.Config
 	if err := config.Load(&cfg); err != nil {
-		log.Fatalf("FATAL: Could not load configuration.\n%v", err)
+		logging.Fatal("Could not load configuration", err)
 	}
-
-	// Initialise Meilisearch indexes if they don't exist
-	if err := clients.InitIndexes(ctx, cfg); err != nil {
-		log.Fatalf("FATAL: Could not initialise Meilisearch.\n%v", err)
+	if err := logging.Setup(cfg); err != nil {
+		logging.Fatal("Could not set up logging", err)
 	}
-
-	pastMeta, err := clients.GetMetadata(ctx, cfg)
-	if err != nil {
-		log.Fatalf("FATAL: Could not get metadata from Meilisearch.\n%v", err)
+	if err := handlers.ValidateWebhookConfig(cfg); err != nil {
+		logging.Fatal("Invalid webhook configuration", err)
 	}
 
-	if err = handlers.ValidateImportInterval(pastMeta); err != nil {
-		log.Fatalf("FATAL: Could not validate import interval.\n%v", err)
+	shutdownTracing, err := tracing.Setup(ctx, cfg, "michiru-importer")
+	if err != nil {
+		logging.Fatal("Could not set up tracing", err)
 	}
 
-	b, err := handlers.FetchDump(ctx, cfg)
+	backend, err := clients.NewBackend(cfg)
 	if err != nil {
-		log.Fatalf("FATAL: Could not fetch title dump.\n%v", err)
+		logging.Fatal("Could not create search backend", err)
 	}
 
-	if err = handlers.ValidateXml(b); err != nil {
-		log.Fatalf("FATAL: Could not validate title dump.\n%v", err)
-	}
+	job := handlers.NewImportJob(models.TriggerImporter, false)
+	err = handlers.RunImport(ctx, cfg, backend, job)
 
-	anime, meta, err := handlers.ParseDump(b)
-	if err != nil {
-		log.Fatalf("FATAL: Could not parse title dump.\n%v", err)
+	// Write metrics of failed imports too, so they can be alerted on
+	if cfg.MetricsTextfile != "" {
+		metrics.Registry.MustRegister(metrics.NewIndexCollector(backend))
+		if merr := metrics.WriteTextfile(cfg.MetricsTextfile); merr != nil {
+			slog.Error("Could not write metrics textfile", "error", merr)
+		}
 	}
 
-	if err = clients.AddAnime(ctx, cfg, anime); err != nil {
-		log.Fatalf("FATAL: Could not add anime to Meilisearch.\n%v", err)
+	// Flush spans of failed imports too, as the process exits straight away
+	if terr := shutdownTracing(context.Background()); terr != nil {
+		slog.Warn("Could not flush traces", "error", terr)
 	}
 
-	if err = clients.UpdateMetadata(ctx, cfg, meta); err != nil {
-		log.Fatalf("FATAL: Could not update metadata in Meilisearch.\n%v", err)
+	if err != nil {
+		logging.Fatal("Could not import title dump", err)
 	}
 }
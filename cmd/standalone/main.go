@@ -0,0 +1,15 @@
+package main
+
+import (
+	"michiru/config"
+	"michiru/internal/app"
+)
+
+// Standalone serves the API from an index stored in DataDir, importing the
+// title dump itself on ImportSchedule, or every ImportInterval by default.
+// No external services are needed.
+func main() {
+	app.Run("michiru-standalone", func(cfg *config.Config) {
+		cfg.SearchBackend = "disk"
+	})
+}
@@ -15,15 +15,112 @@ import (
 type Config struct {
 	Port      string `env:"PORT,default=8080"`
 	WebUIPath string `env:"WEBUI_PATH,default=./static"`
-
-	TitleDumpURL string        `env:"TITLE_DUMP_URL,required"`
+	// Either "text" or "json", logging records at LogLevel and above
+	LogFormat string `env:"LOG_FORMAT,default=text"`
+	LogLevel  string `env:"LOG_LEVEL,default=info"`
+
+	// Limits of the HTTP server, see http.Server
+	ReadHeaderTimeout time.Duration `env:"READ_HEADER_TIMEOUT,default=10s"`
+	ReadTimeout       time.Duration `env:"READ_TIMEOUT,default=30s"`
+	WriteTimeout      time.Duration `env:"WRITE_TIMEOUT,default=60s"`
+	IdleTimeout       time.Duration `env:"IDLE_TIMEOUT,default=120s"`
+	MaxHeaderBytes    int           `env:"MAX_HEADER_BYTES,default=16384"`
+	// Requests received while this many are being served are rejected with a
+	// 503, 0 disables the limit
+	MaxConcurrentRequests int `env:"MAX_CONCURRENT_REQUESTS,default=512"`
+	// Event streams are exempt from MaxConcurrentRequests as they are
+	// long-lived, and are instead rejected with a 503 while this many are open
+	MaxEventStreams int `env:"MAX_EVENT_STREAMS,default=64"`
+	// How long in-flight requests are given to complete on shutdown
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT,default=10s"`
+
+	// Either "none", "otlp", sending spans to TraceEndpoint over HTTP, or
+	// "stdout", for debugging
+	TraceExporter string `env:"TRACE_EXPORTER,default=none"`
+	// OTLP collector URL, defaulting to OTEL_EXPORTER_OTLP_ENDPOINT or
+	// http://localhost:4318 if empty
+	TraceEndpoint string `env:"TRACE_ENDPOINT"`
+	// Fraction of new traces sampled, traces continued from a client follow
+	// its sampling decision
+	TraceSampleRatio float64 `env:"TRACE_SAMPLE_RATIO,default=1"`
+	// Maximum number of aids accepted by a single batch lookup
+	BatchLimit int `env:"BATCH_LIMIT,default=500"`
+	// Maximum age of the last retrieved dump before /readyz fails, 0 disables
+	// the check
+	ReadyMaxStaleness time.Duration `env:"READY_MAX_STALENESS,default=72h"`
+	// Bearer token for the admin API, which is disabled if empty
+	AdminToken string `env:"ADMIN_TOKEN"`
+
+	// API keys sent in the X-Api-Key header, comma-separated, each optionally
+	// followed by its own quota as key:rate or key:rate:burst
+	APIKeys []string `env:"API_KEYS"`
+	// File with one API key per line in the same format as APIKeys
+	APIKeysFile string `env:"API_KEYS_FILE"`
+	// Reject API requests without a key, instead of limiting them by client IP
+	APIKeyRequired bool `env:"API_KEY_REQUIRED,default=false"`
+	// Requests per second each client may make to the API on average, up to
+	// RateBurst at once, 0 disables the limit
+	RateLimit float64 `env:"RATE_LIMIT,default=0"`
+	RateBurst int     `env:"RATE_BURST,default=20"`
+	// IPs or CIDR ranges of reverse proxies whose X-Forwarded-For is trusted
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// Origins allowed to call the API from browsers, comma-separated, where *
+	// allows any origin, or any subdomain as in https://*.example.com. CORS is
+	// disabled if empty
+	CORSOrigins []string `env:"CORS_ORIGINS"`
+	// Methods and request headers allowed from other origins, defaulting to the
+	// methods of each route and the headers read by the API
+	CORSMethods []string `env:"CORS_METHODS"`
+	CORSHeaders []string `env:"CORS_HEADERS"`
+	// How long browsers may cache the response to a preflight request
+	CORSMaxAge time.Duration `env:"CORS_MAX_AGE,default=10m"`
+
+	TitleDumpURL string `env:"TITLE_DUMP_URL,required"`
+	// How long to wait for the response headers when fetching the dump
 	FetchTimeout time.Duration `env:"FETCH_TIMEOUT,default=30s"`
-
-	MeilisearchURL string `env:"MEILISEARCH_URL,required"`
-	MeilisearchKey string `env:"MEILISEARCH_KEY,required"`
+	// Minimum time between imports, checked against the last import's metadata
+	ImportInterval time.Duration `env:"IMPORT_INTERVAL,default=24h"`
+	// Cron expression or interval on which the server runs imports itself,
+	// disabled if empty
+	ImportSchedule string `env:"IMPORT_SCHEDULE"`
+	// Maximum random delay added to each scheduled import
+	ImportJitter time.Duration `env:"IMPORT_JITTER,default=5m"`
+	// Number of times a failed scheduled import is retried, with the backoff
+	// doubling after each attempt
+	ImportRetries      int           `env:"IMPORT_RETRIES,default=5"`
+	ImportRetryBackoff time.Duration `env:"IMPORT_RETRY_BACKOFF,default=1m"`
+	// Either "structural" (pure Go) or "xsd" (libxml2, requires cgo)
+	DumpValidator string `env:"DUMP_VALIDATOR,default=structural"`
+
+	// URLs receiving a signed POST after each import, comma-separated
+	WebhookURLs   []string `env:"WEBHOOK_URLS"`
+	WebhookSecret string   `env:"WEBHOOK_SECRET"`
+	// Number of times a failed webhook delivery is retried, with the backoff
+	// starting at a second and doubling after each attempt
+	WebhookRetries int           `env:"WEBHOOK_RETRIES,default=3"`
+	WebhookTimeout time.Duration `env:"WEBHOOK_TIMEOUT,default=10s"`
+	// Total time the deliveries of an import may take including retries, as
+	// the import is only finished once they are done
+	WebhookDeadline time.Duration `env:"WEBHOOK_DEADLINE,default=30s"`
+
+	// File the importer writes its metrics to after each run, for the
+	// node_exporter textfile collector
+	MetricsTextfile string `env:"METRICS_TEXTFILE"`
+
+	// Either "meilisearch", "memory", an in-process index lost on restart, or
+	// "disk", an in-process index saved to DataDir
+	SearchBackend string `env:"SEARCH_BACKEND,default=meilisearch"`
+	DataDir       string `env:"DATA_DIR,default=./data"`
+
+	// Only required by the meilisearch backend
+	MeilisearchURL string `env:"MEILISEARCH_URL"`
+	MeilisearchKey string `env:"MEILISEARCH_KEY"`
 	IndexName      string `env:"INDEX_NAME,default=titles"`
 
 	TaskTimeout time.Duration `env:"TASK_TIMEOUT,default=0"`
+	// Number of documents submitted to Meilisearch per task during an import
+	ImportBatchSize int `env:"IMPORT_BATCH_SIZE,default=1000"`
 }
 
 // Load populates the given struct pointer with values from environment variables.
@@ -139,6 +236,18 @@ func setField(field reflect.Value, value string) error {
 			return err
 		}
 		field.SetFloat(floatVal)
+	case reflect.Slice:
+		// Only string slices are supported, given as comma-separated values
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type: %s", field.Type())
+		}
+		values := make([]string, 0)
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
 	default:
 		return fmt.Errorf("unsupported field type: %s", field.Kind())
 	}
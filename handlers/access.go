@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"michiru/internal/logging"
+	"michiru/internal/metrics"
+)
+
+// RequestIdHeader holds the id of a request, which is taken from the client
+// if valid and generated otherwise, and echoed in the response.
+const RequestIdHeader = "X-Request-Id"
+
+var requestIdRegexp = regexp.MustCompile(`^[\w.-]{1,64}$`)
+
+type accessKey struct{}
+
+// accessWriter records the details of a response for its access log.
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	// Number of anime matched by a query, or -1 if the route is not a query
+	results int
+}
+
+func (w *accessWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog logs every request served by next once it completes, tagging
+// everything logged while serving it with its request id. It must wrap any
+// middleware reading the route pattern of the request, as it replaces the
+// request passed on.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIdHeader)
+		if !requestIdRegexp.MatchString(id) {
+			id = newId()
+		}
+		w.Header().Set(RequestIdHeader, id)
+
+		aw := &accessWriter{ResponseWriter: w, status: http.StatusOK, results: -1}
+		ctx := logging.WithAttrs(r.Context(), slog.String("request_id", id))
+		ctx = context.WithValue(ctx, accessKey{}, aw)
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(aw, r)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", r.Pattern),
+			slog.Int("status", aw.status),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+		}
+		if aw.results >= 0 {
+			attrs = append(attrs, slog.Int("results", aw.results))
+		}
+
+		level := slog.LevelInfo
+		if aw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx, level, "Served request", attrs...)
+	})
+}
+
+// observeResults records the number of anime matched by a query in the search
+// result metrics and the access log of the request.
+func observeResults(r *http.Request, endpoint string, count int) {
+	metrics.SearchResults.WithLabelValues(endpoint).Observe(float64(count))
+
+	if aw, ok := r.Context().Value(accessKey{}).(*accessWriter); ok {
+		aw.results = count
+	}
+}
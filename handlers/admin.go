@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"michiru/config"
+	"michiru/models"
+)
+
+// requireAdmin rejects requests without cfg.AdminToken as a bearer token.
+func requireAdmin(cfg config.Config, next http.HandlerFunc) http.HandlerFunc {
+	expected := []byte("Bearer " + cfg.AdminToken)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func HandleAdminImport(runner *ImportRunner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.ImportRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10))
+		if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(
+				w, fmt.Sprintf("invalid request body: %s", err),
+				http.StatusBadRequest,
+			)
+			return
+		}
+		if force := r.URL.Query().Get("force"); force != "" {
+			var err error
+			if req.Force, err = strconv.ParseBool(force); err != nil {
+				writeError(w, "force must be a boolean", http.StatusBadRequest)
+				return
+			}
+		}
+
+		job, err := runner.Start(models.TriggerAdmin, req.Force)
+		if errors.Is(err, ErrImportRunning) {
+			writeError(
+				w, fmt.Sprintf("import %s is already running", job.Id()),
+				http.StatusConflict,
+			)
+			return
+		}
+
+		w.Header().Set("Location", "/admin/import/"+job.Id())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+
+		err = json.NewEncoder(w).Encode(job.Info())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+func HandleAdminImportJob(runner *ImportRunner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job := runner.Job(r.PathValue("id"))
+		if job == nil {
+			writeError(w, "import not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err := json.NewEncoder(w).Encode(job.Info())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+func HandleAdminImports(runner *ImportRunner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := models.ImportJobsResponse{Payload: runner.Jobs()}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err := json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"michiru/config"
@@ -22,16 +25,55 @@ func decodeQueryParams(r *http.Request) (*models.QueryParams, error) {
 		return nil, errors.New("query cannot be empty")
 	}
 
+	offset, limit, err := decodePaging(reqParams, 10, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	langs := splitParam(reqParams.Get("lang"))
+	for _, lang := range langs {
+		if !languageRegexp.MatchString(lang) {
+			return nil, fmt.Errorf("lang %q is not a valid language code", lang)
+		}
+	}
+
+	types := splitParam(reqParams.Get("type"))
+	for _, titleType := range types {
+		if !slices.Contains(models.TitleTypes, titleType) {
+			return nil, fmt.Errorf(
+				"type must be one of %s", strings.Join(models.TitleTypes, ", "),
+			)
+		}
+	}
+
+	return &models.QueryParams{
+		Query:  query,
+		Limit:  limit,
+		Offset: offset,
+		Langs:  langs,
+		Types:  types,
+	}, nil
+}
+
+// decodePaging reads the offset and limit query parameters, using defaultLimit
+// if no limit is given. The offset must not be negative and the limit must be
+// positive.
+func decodePaging(
+	reqParams url.Values, defaultLimit int, maxLimit int,
+) (int, int, error) {
 	limitStr := reqParams.Get("limit")
 	if limitStr == "" {
-		limitStr = "10"
+		limitStr = strconv.Itoa(defaultLimit)
 	}
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
-		return nil, fmt.Errorf("limit must be an integer: %w", err)
+		return 0, 0, fmt.Errorf("limit must be an integer: %w", err)
+	}
+	if limit <= 0 {
+		return 0, 0, errors.New("limit must be positive")
 	}
-	if limit > 50 {
-		return nil, errors.New("limit cannot exceed 50")
+	if limit > maxLimit {
+		return 0, 0, fmt.Errorf("limit cannot exceed %d", maxLimit)
 	}
 
 	offsetStr := reqParams.Get("offset")
@@ -40,35 +82,45 @@ func decodeQueryParams(r *http.Request) (*models.QueryParams, error) {
 	}
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil {
-		return nil, fmt.Errorf("offset must be an integer: %w", err)
+		return 0, 0, fmt.Errorf("offset must be an integer: %w", err)
+	}
+	if offset < 0 {
+		return 0, 0, errors.New("offset cannot be negative")
 	}
 
-	return &models.QueryParams{
-		Query:  query,
-		Limit:  limit,
-		Offset: offset,
-	}, nil
+	return offset, limit, nil
 }
 
+// splitParam splits a comma-separated query parameter, ignoring empty values.
+func splitParam(param string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(param, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// toPaging returns links to the next and previous pages of a paginated
+// response, keeping the given query parameters.
 func toPaging(
-	req *url.URL, params *models.QueryParams, count int,
+	req *url.URL, queryParams url.Values, offset int, limit int, count int,
 ) models.PagingResponse {
-	queryParams := params.ToQueryString()
-
 	var next string
 	var prev string
 	resp := models.PagingResponse{Count: count}
 
-	nextOffset := params.Offset + params.Limit
+	nextOffset := offset + limit
 	if nextOffset < count {
 		queryParams.Set("offset", strconv.Itoa(nextOffset))
 		next = fmt.Sprintf("%s?%s", req.Path, queryParams.Encode())
 	}
 
-	if prevOffset := params.Offset - params.Limit; prevOffset >= 0 {
+	if prevOffset := offset - limit; prevOffset >= 0 {
 		queryParams.Set("offset", strconv.Itoa(prevOffset))
 		prev = fmt.Sprintf("%s?%s", req.Path, queryParams.Encode())
-	} else if params.Offset != 0 {
+	} else if offset != 0 {
 		queryParams.Set("offset", "0")
 		prev = fmt.Sprintf("%s?%s", req.Path, queryParams.Encode())
 	}
@@ -82,7 +134,7 @@ func toPaging(
 	return resp
 }
 
-func HandleSearch(cfg config.Config) http.HandlerFunc {
+func HandleSearch(backend clients.SearchBackend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params, err := decodeQueryParams(r)
 		if err != nil {
@@ -90,13 +142,16 @@ func HandleSearch(cfg config.Config) http.HandlerFunc {
 			return
 		}
 
-		data, count, err := clients.SearchAnime(cfg, params)
+		data, count, err := backend.SearchAnime(r.Context(), params)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		observeResults(r, "search", count)
 
-		paging := toPaging(r.URL, params, count)
+		paging := toPaging(
+			r.URL, params.ToQueryString(), params.Offset, params.Limit, count,
+		)
 
 		resp := models.QueryResponse{
 			Payload: data,
@@ -116,38 +171,249 @@ func HandleSearch(cfg config.Config) http.HandlerFunc {
 	}
 }
 
-func HandleMetadata(cfg config.Config) http.HandlerFunc {
+func HandleMetadata(backend clients.SearchBackend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		meta, err := clients.GetMetadata(r.Context(), cfg)
+		meta, err := backend.GetMetadata(r.Context())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// The importer runs daily by default, so data should be valid for a day
-		const validDuration = 24 * time.Hour
-		expiresTime := meta.RetrievedAt.Add(validDuration)
+		setCacheHeaders(w, meta)
 
-		var maxAgeSeconds int
-		if time.Now().Before(expiresTime) {
-			maxAgeSeconds = int(time.Until(expiresTime).Seconds())
-		} else {
-			maxAgeSeconds = 0
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(meta)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 
-		// Set headers to support caching, revalidate every 24 hours
-		w.Header().Set(
-			"Cache-Control", fmt.Sprintf("public, max-age=%d", maxAgeSeconds),
-		)
-		w.Header().Set("Expires", expiresTime.UTC().Format(http.TimeFormat))
-		w.Header().Set(
-			"Last-Modified", meta.RetrievedAt.UTC().Format(http.TimeFormat),
+		return
+	}
+}
+
+func HandleMetadataHistory(backend clients.SearchBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		offset, limit, err := decodePaging(r.URL.Query(), 10, 50)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		reports, count, err := backend.GetImportReports(r.Context(), offset, limit)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		queryParams := url.Values{"limit": {strconv.Itoa(limit)}}
+		resp := models.ImportHistoryResponse{
+			Payload: reports,
+			Paging:  toPaging(r.URL, queryParams, offset, limit, count),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+func HandleAnime(backend clients.SearchBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		aid, err := parseAid(r.PathValue("aid"))
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		anime, err := backend.GetAnime(r.Context(), aid)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if anime == nil {
+			writeError(w, "anime not found", http.StatusNotFound)
+			return
+		}
+
+		meta, err := backend.GetMetadata(r.Context())
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		setCacheHeaders(w, meta)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(anime)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+func HandleAnimeHistory(backend clients.SearchBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		aid, err := parseAid(r.PathValue("aid"))
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		changes, err := backend.GetAnimeTitleChanges(r.Context(), aid)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		resp := models.TitleChangesResponse{Payload: changes}
+		err = json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+func HandleChanges(backend clients.SearchBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqParams := r.URL.Query()
+
+		var since time.Time
+		if sinceStr := reqParams.Get("since"); sinceStr != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, sinceStr); err != nil {
+				writeError(
+					w, "since must be an RFC 3339 timestamp",
+					http.StatusBadRequest,
+				)
+				return
+			}
+		}
+
+		offset, limit, err := decodePaging(reqParams, 100, 1000)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		changes, count, err := backend.GetTitleChanges(
+			r.Context(), since, offset, limit,
 		)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		queryParams := url.Values{"limit": {strconv.Itoa(limit)}}
+		if !since.IsZero() {
+			queryParams.Set("since", since.Format(time.RFC3339Nano))
+		}
+		paging := toPaging(r.URL, queryParams, offset, limit, count)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
-		err = json.NewEncoder(w).Encode(meta)
+		resp := models.TitleChangesResponse{Payload: changes, Paging: &paging}
+		err = json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+func HandleAnimeBatch(
+	cfg config.Config, backend clients.SearchBackend,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		aids, err := decodeBatchAids(w, r, cfg.BatchLimit)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		anime, err := backend.GetAnimeBatch(r.Context(), aids)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := models.BatchResponse{
+			Anime:   anime,
+			Unknown: make([]string, 0),
+		}
+		for _, aid := range aids {
+			if _, ok := anime[aid]; !ok {
+				resp.Unknown = append(resp.Unknown, aid)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+func HandleSuggest(backend clients.SearchBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqParams := r.URL.Query()
+
+		query := reqParams.Get("q")
+		if query == "" {
+			writeError(w, "q cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		limitStr := reqParams.Get("limit")
+		if limitStr == "" {
+			limitStr = "5"
+		}
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			writeError(
+				w, "limit must be a positive integer", http.StatusBadRequest,
+			)
+			return
+		}
+		if limit > 20 {
+			writeError(w, "limit cannot exceed 20", http.StatusBadRequest)
+			return
+		}
+
+		data, err := backend.SuggestTitles(r.Context(), query, limit)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		observeResults(r, "suggest", len(data))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(models.SuggestResponse{Payload: data})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
@@ -155,3 +421,142 @@ func HandleMetadata(cfg config.Config) http.HandlerFunc {
 		return
 	}
 }
+
+func HandleResolve(backend clients.SearchBackend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filename := r.URL.Query().Get("filename")
+		if filename == "" {
+			writeError(w, "filename cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		info := ParseReleaseName(filename)
+		if info.Title == "" {
+			writeError(
+				w, "could not find a title in filename", http.StatusBadRequest,
+			)
+			return
+		}
+
+		params := &models.QueryParams{Query: SearchQuery(info), Limit: 1}
+		data, count, err := backend.SearchAnime(r.Context(), params)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		observeResults(r, "resolve", count)
+		if len(data) == 0 {
+			writeError(w, "no matching anime found", http.StatusNotFound)
+			return
+		}
+
+		resp := models.ResolveResponse{
+			Aid:        data[0].Aid,
+			MainTitle:  data[0].MainTitle,
+			Confidence: data[0].RankingScore,
+			Parsed:     info,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+// decodeBatchAids reads the aids of a batch lookup from either a JSON request
+// body or a comma-separated aid query parameter, removing duplicates.
+func decodeBatchAids(
+	w http.ResponseWriter, r *http.Request, limit int,
+) ([]string, error) {
+	var raw []string
+	if r.Method == http.MethodPost {
+		var req models.BatchRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err := dec.Decode(&req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+		for _, aid := range req.Aids {
+			raw = append(raw, aid.String())
+		}
+	} else if param := r.URL.Query().Get("aid"); param != "" {
+		raw = strings.Split(param, ",")
+	}
+
+	if len(raw) == 0 {
+		return nil, errors.New("aids cannot be empty")
+	}
+
+	seen := make(map[string]bool, len(raw))
+	aids := make([]string, 0, len(raw))
+	for _, aid := range raw {
+		aid, err := parseAid(strings.TrimSpace(aid))
+		if err != nil {
+			return nil, err
+		}
+		if !seen[aid] {
+			seen[aid] = true
+			aids = append(aids, aid)
+		}
+	}
+
+	if len(aids) > limit {
+		return nil, fmt.Errorf("cannot look up more than %d aids", limit)
+	}
+
+	return aids, nil
+}
+
+// parseAid validates an aid given in a request, normalising it so that e.g.
+// "007" and "7" are treated as the same aid.
+func parseAid(s string) (string, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return "", fmt.Errorf("aid %q must be a positive integer", s)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// setCacheHeaders sets headers allowing clients to cache responses until the
+// next expected import. Nothing is set if there has been no import yet.
+func setCacheHeaders(w http.ResponseWriter, meta *models.MetadataDocument) {
+	if meta == nil {
+		return
+	}
+
+	// The importer runs daily by default, so data should be valid for a day
+	const validDuration = 24 * time.Hour
+	expiresTime := meta.RetrievedAt.Add(validDuration)
+
+	var maxAgeSeconds int
+	if time.Now().Before(expiresTime) {
+		maxAgeSeconds = int(time.Until(expiresTime).Seconds())
+	} else {
+		maxAgeSeconds = 0
+	}
+
+	// Set headers to support caching, revalidate every 24 hours
+	w.Header().Set(
+		"Cache-Control", fmt.Sprintf("public, max-age=%d", maxAgeSeconds),
+	)
+	w.Header().Set("Expires", expiresTime.UTC().Format(http.TimeFormat))
+	w.Header().Set(
+		"Last-Modified", meta.RetrievedAt.UTC().Format(http.TimeFormat),
+	)
+}
+
+// writeError writes msg as a JSON error body with the given status code.
+func writeError(w http.ResponseWriter, msg string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(models.ErrorResponse{Error: msg})
+	if err != nil {
+		slog.Error("Could not write error response", "error", err)
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"michiru/config"
+	"michiru/internal/clients"
+	"michiru/models"
+)
+
+// newTestAPI returns a mux serving the public API from an in-memory backend
+// holding a few anime, title changes and import reports.
+func newTestAPI(t *testing.T) *http.ServeMux {
+	t.Helper()
+	ctx := context.Background()
+	backend := clients.NewMemory(config.Config{IndexName: "anime"})
+
+	anime := []models.AnimeDocument{
+		{
+			Aid: "1", MainTitle: "Cowboy Bebop", MainTitleLang: "x-jat",
+			OfficialTitles: map[string][]string{"en": {"Cowboy Bebop"}},
+		},
+		{
+			Aid: "7", MainTitle: "Cowboy Bebop: Tengoku no Tobira",
+			MainTitleLang:  "x-jat",
+			OfficialTitles: map[string][]string{"en": {"Cowboy Bebop: The Movie"}},
+		},
+		{
+			Aid: "12", MainTitle: "Shingeki no Kyojin", MainTitleLang: "x-jat",
+			OfficialTitles: map[string][]string{"en": {"Attack on Titan"}},
+		},
+	}
+	if err := backend.UpdateAnime(ctx, anime, nil, nil); err != nil {
+		t.Fatalf("UpdateAnime: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	changes := []models.TitleChange{
+		{Id: "c1", Aid: "7", Kind: models.TitleAdded, ChangedAt: start},
+		{
+			Id: "c2", Aid: "12", Kind: models.TitleAdded,
+			ChangedAt: start.Add(time.Hour),
+		},
+		{
+			Id: "c3", Aid: "7", Kind: models.TitleRemoved,
+			ChangedAt: start.Add(2 * time.Hour),
+		},
+	}
+	if err := backend.AddTitleChanges(ctx, changes); err != nil {
+		t.Fatalf("AddTitleChanges: %v", err)
+	}
+	for i := range 3 {
+		report := models.ImportReport{
+			Id:        string(rune('a' + i)),
+			StartedAt: start.Add(time.Duration(i) * time.Hour),
+		}
+		if err := backend.AddImportReport(ctx, report); err != nil {
+			t.Fatalf("AddImportReport: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", HandleSearch(backend))
+	mux.HandleFunc("GET /metadata/history", HandleMetadataHistory(backend))
+	mux.HandleFunc("GET /anime/{aid}", HandleAnime(backend))
+	mux.HandleFunc("GET /anime/{aid}/history", HandleAnimeHistory(backend))
+	mux.HandleFunc("GET /changes", HandleChanges(backend))
+	mux.HandleFunc(
+		"GET /anime", HandleAnimeBatch(config.Config{BatchLimit: 2}, backend),
+	)
+	mux.HandleFunc("GET /suggest", HandleSuggest(backend))
+	mux.HandleFunc("GET /resolve", HandleResolve(backend))
+	return mux
+}
+
+// serveTest serves a GET request for target, decoding a successful JSON
+// response into v.
+func serveTest(
+	t *testing.T, mux *http.ServeMux, target string, v any,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code == http.StatusOK && v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("GET %s: invalid response %q: %v", target, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+func TestHandleSearch(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.QueryResponse
+	rec := serveTest(t, mux, "/search?query=cowboy&limit=1&offset=1", &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.Payload) != 1 || resp.Payload[0].Aid != "7" {
+		t.Errorf("got payload %v, want aid 7", resp.Payload)
+	}
+	if resp.Paging.Count != 2 || resp.Paging.Next != nil ||
+		resp.Paging.Prev == nil ||
+		!strings.Contains(*resp.Paging.Prev, "offset=0") {
+		t.Errorf("got paging %+v", resp.Paging)
+	}
+
+	for _, target := range []string{
+		"/search",
+		"/search?query=cowboy&offset=-1",
+		"/search?query=cowboy&limit=0",
+		"/search?query=cowboy&limit=51",
+		"/search?query=cowboy&lang=english-",
+	} {
+		if rec := serveTest(t, mux, target, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: got status %d, want 400", target, rec.Code)
+		}
+	}
+}
+
+func TestHandleAnime(t *testing.T) {
+	mux := newTestAPI(t)
+
+	cases := []struct {
+		target string
+		code   int
+		aid    json.Number
+	}{
+		{"/anime/7", http.StatusOK, "7"},
+		{"/anime/007", http.StatusOK, "7"},
+		{"/anime/8", http.StatusNotFound, ""},
+		{"/anime/0", http.StatusBadRequest, ""},
+		{"/anime/abc", http.StatusBadRequest, ""},
+	}
+	for _, c := range cases {
+		var doc models.AnimeDocument
+		rec := serveTest(t, mux, c.target, &doc)
+		if rec.Code != c.code || doc.Aid != c.aid {
+			t.Errorf(
+				"GET %s: got status %d, aid %q, want %d, %q",
+				c.target, rec.Code, doc.Aid, c.code, c.aid,
+			)
+		}
+	}
+}
+
+func TestHandleAnimeHistory(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.TitleChangesResponse
+	rec := serveTest(t, mux, "/anime/007/history", &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.Payload) != 2 || resp.Payload[0].Id != "c1" ||
+		resp.Payload[1].Id != "c3" {
+		t.Errorf("got payload %v, want changes c1 and c3", resp.Payload)
+	}
+}
+
+func TestHandleChanges(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.TitleChangesResponse
+	target := "/changes?since=2024-01-01T00:00:00Z&limit=1"
+	rec := serveTest(t, mux, target, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.Payload) != 1 || resp.Payload[0].Id != "c2" {
+		t.Errorf("got payload %v, want change c2", resp.Payload)
+	}
+	if resp.Paging == nil || resp.Paging.Count != 2 || resp.Paging.Next == nil {
+		t.Fatalf("got paging %+v", resp.Paging)
+	}
+
+	next := *resp.Paging.Next
+	resp = models.TitleChangesResponse{}
+	serveTest(t, mux, next, &resp)
+	if len(resp.Payload) != 1 || resp.Payload[0].Id != "c3" {
+		t.Errorf("got next page %v, want change c3", resp.Payload)
+	}
+
+	if rec := serveTest(t, mux, "/changes?since=yesterday", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for invalid since, want 400", rec.Code)
+	}
+}
+
+func TestHandleMetadataHistory(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.ImportHistoryResponse
+	rec := serveTest(t, mux, "/metadata/history?limit=2", &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.Payload) != 2 || resp.Payload[0].Id != "c" ||
+		resp.Payload[1].Id != "b" {
+		t.Errorf("got payload %v, want reports c and b", resp.Payload)
+	}
+	if resp.Paging.Count != 3 || resp.Paging.Next == nil {
+		t.Errorf("got paging %+v", resp.Paging)
+	}
+}
+
+func TestHandleAnimeBatch(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.BatchResponse
+	rec := serveTest(t, mux, "/anime?aid=1,01,99", &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := resp.Anime["1"]; !ok || len(resp.Anime) != 1 {
+		t.Errorf("got anime %v, want aid 1", resp.Anime)
+	}
+	if len(resp.Unknown) != 1 || resp.Unknown[0] != "99" {
+		t.Errorf("got unknown aids %v, want [99]", resp.Unknown)
+	}
+
+	for _, target := range []string{"/anime", "/anime?aid=1,x", "/anime?aid=1,2,3"} {
+		if rec := serveTest(t, mux, target, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: got status %d, want 400", target, rec.Code)
+		}
+	}
+}
+
+func TestHandleSuggest(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.SuggestResponse
+	rec := serveTest(t, mux, "/suggest?q=cowboy%20bebop%20the", &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.Payload) != 2 ||
+		resp.Payload[0].MatchedTitle != "Cowboy Bebop: The Movie" {
+		t.Errorf("got suggestions %v", resp.Payload)
+	}
+
+	for _, target := range []string{"/suggest", "/suggest?q=a&limit=21"} {
+		if rec := serveTest(t, mux, target, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: got status %d, want 400", target, rec.Code)
+		}
+	}
+}
+
+func TestHandleResolve(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.ResolveResponse
+	target := "/resolve?filename=" +
+		"%5BGroup%5D%20Attack%20on%20Titan%20-%2003%20%5B1080p%5D.mkv"
+	rec := serveTest(t, mux, target, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Aid != "12" || resp.Parsed.Episode != 3 {
+		t.Errorf("got %+v, want aid 12, episode 3", resp)
+	}
+
+	rec = serveTest(t, mux, "/resolve?filename=Unknown%20Show%20-%2001.mkv", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d for unknown title, want 404", rec.Code)
+	}
+}
+
+func TestHandleChangesSincePrecision(t *testing.T) {
+	mux := newTestAPI(t)
+
+	var resp models.TitleChangesResponse
+	target := "/changes?since=2023-12-31T23:59:59.999999999Z&limit=1"
+	rec := serveTest(t, mux, target, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if resp.Paging == nil || resp.Paging.Next == nil {
+		t.Fatalf("got paging %+v", resp.Paging)
+	}
+	want := "since=2023-12-31T23%3A59%3A59.999999999Z"
+	if !strings.Contains(*resp.Paging.Next, want) {
+		t.Errorf("next link %s does not contain %s", *resp.Paging.Next, want)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"michiru/config"
+)
+
+// Methods the routes of a preflight request are checked for, if CORSMethods
+// is not set.
+var corsMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete,
+}
+
+// Request headers allowed if CORSHeaders is not set.
+var corsHeaders = []string{
+	"Authorization", "Content-Type", APIKeyHeader, RequestIdHeader,
+}
+
+// Response headers readable by browsers besides the safelisted ones.
+var corsExposed = strings.Join([]string{
+	RequestIdHeader, "X-RateLimit-Limit", "X-RateLimit-Remaining",
+	"X-RateLimit-Reset", "Retry-After",
+}, ", ")
+
+// CORS allows the origins in cfg.CORSOrigins to call the routes on mux served
+// by next, answering preflight requests for every route itself so that they
+// are neither authenticated nor rate limited. Requests from other origins are
+// served without CORS headers, so browsers block their responses.
+func CORS(
+	cfg config.Config, next http.Handler, routes *http.ServeMux,
+) http.Handler {
+	if len(cfg.CORSOrigins) == 0 {
+		return next
+	}
+
+	methods := corsMethods
+	if len(cfg.CORSMethods) > 0 {
+		methods = make([]string, 0, len(cfg.CORSMethods))
+		for _, method := range cfg.CORSMethods {
+			methods = append(methods, strings.ToUpper(method))
+		}
+	}
+	headers := corsHeaders
+	if len(cfg.CORSHeaders) > 0 {
+		headers = cfg.CORSHeaders
+	}
+	anyOrigin := slices.Contains(cfg.CORSOrigins, "*")
+	anyHeader := slices.Contains(headers, "*")
+	maxAge := strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		h := w.Header()
+		if !anyOrigin {
+			h.Add("Vary", "Origin")
+		}
+		if origin == "" || !allowOrigin(cfg.CORSOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowedOrigin := origin
+		if anyOrigin {
+			allowedOrigin = "*"
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || method == "" {
+			h.Set("Access-Control-Allow-Origin", allowedOrigin)
+			h.Set("Access-Control-Expose-Headers", corsExposed)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Preflight requests are answered with the methods of the routes
+		// matching the path, leaving the headers out if the requested method
+		// is not among them
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		allowed := routeMethods(routes, r, methods)
+		if len(allowed) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if slices.Contains(allowed, method) {
+			h.Set("Access-Control-Allow-Origin", allowedOrigin)
+			h.Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+			allowHeaders := strings.Join(headers, ", ")
+			if anyHeader {
+				allowHeaders = r.Header.Get("Access-Control-Request-Headers")
+			}
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			if cfg.CORSMaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowOrigin reports whether origin matches one of allowed, where * matches
+// any part of an origin.
+func allowOrigin(allowed []string, origin string) bool {
+	for _, pattern := range allowed {
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if pattern == origin {
+				return true
+			}
+			continue
+		}
+		if len(origin) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) &&
+			strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeMethods returns those of methods which a route on routes accepts for
+// the path of r. The web UI route is left out, as it matches every path and
+// its files are not meant to be fetched cross-origin.
+func routeMethods(
+	routes *http.ServeMux, r *http.Request, methods []string,
+) []string {
+	allowed := make([]string, 0, len(methods))
+	for _, method := range methods {
+		probe := *r
+		probe.Method = method
+		_, pattern := routes.Handler(&probe)
+		if pattern != "" && pattern != webUIPattern {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"michiru/config"
+)
+
+func TestAllowOrigin(t *testing.T) {
+	cases := []struct {
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{[]string{"https://example.com"}, "https://example.com", true},
+		{[]string{"https://example.com"}, "http://example.com", false},
+		{[]string{"https://example.com"}, "https://example.com.evil.com", false},
+		{[]string{"*"}, "https://anything.test", true},
+		{[]string{"https://*.example.com"}, "https://app.example.com", true},
+		{[]string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{[]string{"https://*.example.com"}, "https://example.com", false},
+		{[]string{"https://*.example.com"}, "https://evilexample.com", false},
+		{[]string{"https://*.example.com"}, "http://app.example.com", false},
+		{
+			[]string{"https://example.com", "moz-extension://*"},
+			"moz-extension://1234", true,
+		},
+		{[]string{"https://example.com"}, "https://other.com", false},
+		{nil, "https://example.com", false},
+	}
+	for _, c := range cases {
+		if got := allowOrigin(c.allowed, c.origin); got != c.want {
+			t.Errorf(
+				"allowOrigin(%q, %q) = %t, want %t",
+				c.allowed, c.origin, got, c.want,
+			)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	mux.HandleFunc(webUIPattern, ok)
+	mux.HandleFunc("GET /search", ok)
+	mux.HandleFunc("GET /anime", ok)
+	mux.HandleFunc("POST /anime/batch", ok)
+
+	cfg := config.Config{
+		CORSOrigins: []string{"https://app.example.com"},
+		CORSMaxAge:  10 * time.Minute,
+	}
+	handler := CORS(cfg, mux, mux)
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		origin  string
+		request string
+		code    int
+		// Expected Access-Control-Allow-Origin and -Methods headers
+		allowOrigin  string
+		allowMethods string
+	}{
+		{
+			name: "preflight", method: http.MethodOptions, path: "/search",
+			origin: "https://app.example.com", request: http.MethodGet,
+			code:        http.StatusNoContent,
+			allowOrigin: "https://app.example.com", allowMethods: "GET, HEAD",
+		},
+		{
+			name: "preflight for post route", method: http.MethodOptions,
+			path: "/anime/batch", origin: "https://app.example.com",
+			request: http.MethodPost, code: http.StatusNoContent,
+			allowOrigin: "https://app.example.com", allowMethods: "POST",
+		},
+		{
+			name: "preflight method mismatch", method: http.MethodOptions,
+			path: "/search", origin: "https://app.example.com",
+			request: http.MethodDelete, code: http.StatusNoContent,
+		},
+		{
+			name: "preflight for unknown path", method: http.MethodOptions,
+			path: "/nonexistent", origin: "https://app.example.com",
+			request: http.MethodGet, code: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "preflight for web UI", method: http.MethodOptions,
+			path: "/", origin: "https://app.example.com",
+			request: http.MethodGet, code: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "preflight from disallowed origin",
+			method: http.MethodOptions, path: "/search",
+			origin: "https://evil.example.com", request: http.MethodGet,
+			code: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "request", method: http.MethodGet, path: "/search",
+			origin: "https://app.example.com", code: http.StatusOK,
+			allowOrigin: "https://app.example.com",
+		},
+		{
+			name: "request from disallowed origin", method: http.MethodGet,
+			path: "/search", origin: "https://evil.example.com",
+			code: http.StatusOK,
+		},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set("Origin", c.origin)
+		if c.request != "" {
+			req.Header.Set("Access-Control-Request-Method", c.request)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		h := rec.Header()
+		if rec.Code != c.code ||
+			h.Get("Access-Control-Allow-Origin") != c.allowOrigin ||
+			h.Get("Access-Control-Allow-Methods") != c.allowMethods {
+			t.Errorf(
+				"%s: got status %d, origin %q, methods %q, want %d, %q, %q",
+				c.name, rec.Code, h.Get("Access-Control-Allow-Origin"),
+				h.Get("Access-Control-Allow-Methods"), c.code, c.allowOrigin,
+				c.allowMethods,
+			)
+		}
+		if c.allowMethods != "" && h.Get("Access-Control-Max-Age") != "600" {
+			t.Errorf(
+				"%s: got max age %q, want 600", c.name,
+				h.Get("Access-Control-Max-Age"),
+			)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"michiru/models"
+)
+
+// AnimeDiffer compares streamed anime against the content hashes from the
+// previous import.
+type AnimeDiffer struct {
+	prevHashes map[string]string
+	seen       map[string]bool
+	diff       models.AnimeDiff
+}
+
+func NewAnimeDiffer(prevHashes map[string]string) *AnimeDiffer {
+	return &AnimeDiffer{
+		prevHashes: prevHashes,
+		seen:       make(map[string]bool, len(prevHashes)),
+		diff: models.AnimeDiff{
+			Added:    make([]string, 0),
+			Modified: make([]string, 0),
+			Removed:  make([]string, 0),
+		},
+	}
+}
+
+// Add records the anime as present in the new dump, returning whether it is
+// new or has changed since the previous import.
+func (d *AnimeDiffer) Add(doc models.AnimeDocument) bool {
+	aid := doc.Aid.String()
+	d.seen[aid] = true
+
+	prevHash, exists := d.prevHashes[aid]
+	if !exists {
+		d.diff.Added = append(d.diff.Added, aid)
+		return true
+	} else if prevHash != doc.Hash() {
+		d.diff.Modified = append(d.diff.Modified, aid)
+		return true
+	}
+
+	return false
+}
+
+// Diff returns the changes recorded so far. Anime from the previous import
+// which have not been added are treated as removed.
+func (d *AnimeDiffer) Diff() *models.AnimeDiff {
+	d.diff.Removed = d.diff.Removed[:0]
+	for aid := range d.prevHashes {
+		if !d.seen[aid] {
+			d.diff.Removed = append(d.diff.Removed, aid)
+		}
+	}
+
+	return &d.diff
+}
+
+// TitleChanges returns the title changes between the previous and current
+// version of an anime, either of which may be nil if the anime was added or
+// removed.
+//
+// Change ids are derived from the change and the hash of the previous version,
+// rather than the time of the import, so that the changes recorded by a failed
+// import which is retried are replaced instead of duplicated.
+func TitleChanges(
+	prev *models.AnimeDocument, curr *models.AnimeDocument, at time.Time,
+) []models.TitleChange {
+	var prevHash string
+	if prev != nil {
+		prevHash = prev.Hash()
+	}
+
+	changes := make([]models.TitleChange, 0)
+	// Number of identical changes so far, as a title may appear twice
+	seen := make(map[string]int)
+	add := func(aid json.Number, kind string, title models.TitleDocument) {
+		key := fmt.Sprintf(
+			"%s\x00%s\x00%s\x00%s\x00%s",
+			prevHash, kind, title.Type, title.Lang, title.Title,
+		)
+		sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%d", key, seen[key]))
+		seen[key]++
+
+		changes = append(
+			changes, models.TitleChange{
+				Id:        fmt.Sprintf("%s-%x", aid, sum[:8]),
+				Aid:       aid,
+				Kind:      kind,
+				Title:     title.Title,
+				Lang:      title.Lang,
+				Type:      title.Type,
+				ChangedAt: at,
+			},
+		)
+	}
+
+	if prev == nil || curr == nil {
+		doc, kind := curr, models.TitleAdded
+		if doc == nil {
+			doc, kind = prev, models.TitleRemoved
+		}
+		if doc == nil {
+			return changes
+		}
+
+		for _, title := range doc.Titles() {
+			add(doc.Aid, kind, title)
+		}
+		return changes
+	}
+
+	if prev.MainTitle != curr.MainTitle || prev.MainTitleLang != curr.MainTitleLang {
+		add(
+			curr.Aid, models.MainTitleChanged, models.TitleDocument{
+				Title: curr.MainTitle,
+				Lang:  curr.MainTitleLang,
+				Type:  "main",
+			},
+		)
+		changes[len(changes)-1].Previous = prev.MainTitle
+		changes[len(changes)-1].PreviousLang = prev.MainTitleLang
+	}
+
+	// Compare the other titles as multisets, as a title may appear twice
+	type titleKey struct{ title, lang, titleType string }
+	counts := make(map[titleKey]int)
+	for _, title := range prev.Titles() {
+		if title.Type != "main" {
+			counts[titleKey{title.Title, title.Lang, title.Type}]--
+		}
+	}
+	for _, title := range curr.Titles() {
+		if title.Type != "main" {
+			counts[titleKey{title.Title, title.Lang, title.Type}]++
+		}
+	}
+
+	for _, title := range curr.Titles() {
+		key := titleKey{title.Title, title.Lang, title.Type}
+		if counts[key] > 0 {
+			counts[key]--
+			add(curr.Aid, models.TitleAdded, title)
+		}
+	}
+	for _, title := range prev.Titles() {
+		key := titleKey{title.Title, title.Lang, title.Type}
+		if counts[key] < 0 {
+			counts[key]++
+			add(curr.Aid, models.TitleRemoved, title)
+		}
+	}
+
+	return changes
+}
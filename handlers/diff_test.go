@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"michiru/models"
+)
+
+// changeSummary is a title change without its id and time, for comparison.
+type changeSummary struct {
+	kind, title, lang, titleType, previous string
+}
+
+func summarise(changes []models.TitleChange) []changeSummary {
+	summaries := make([]changeSummary, 0, len(changes))
+	for _, c := range changes {
+		summaries = append(
+			summaries, changeSummary{c.Kind, c.Title, c.Lang, c.Type, c.Previous},
+		)
+	}
+	return summaries
+}
+
+func TestTitleChanges(t *testing.T) {
+	base := models.AnimeDocument{
+		Aid:            "1",
+		MainTitle:      "Test Anime",
+		MainTitleLang:  "x-jat",
+		OfficialTitles: map[string][]string{"en": {"Test"}},
+	}
+	renamed := base
+	renamed.MainTitle = "Test Anime (2025)"
+	extended := base
+	extended.OfficialTitles = map[string][]string{"en": {"Test", "Testing"}}
+	duplicated := base
+	duplicated.SynonymousTitles = map[string][]string{"en": {"TA", "TA"}}
+	deduplicated := base
+	deduplicated.SynonymousTitles = map[string][]string{"en": {"TA"}}
+
+	cases := []struct {
+		name string
+		prev *models.AnimeDocument
+		curr *models.AnimeDocument
+		want []changeSummary
+	}{
+		{
+			name: "added anime",
+			curr: &base,
+			want: []changeSummary{
+				{models.TitleAdded, "Test Anime", "x-jat", "main", ""},
+				{models.TitleAdded, "Test", "en", "official", ""},
+			},
+		},
+		{
+			name: "removed anime",
+			prev: &base,
+			want: []changeSummary{
+				{models.TitleRemoved, "Test Anime", "x-jat", "main", ""},
+				{models.TitleRemoved, "Test", "en", "official", ""},
+			},
+		},
+		{
+			name: "unchanged",
+			prev: &base,
+			curr: &base,
+			want: []changeSummary{},
+		},
+		{
+			name: "renamed main title",
+			prev: &base,
+			curr: &renamed,
+			want: []changeSummary{
+				{
+					models.MainTitleChanged, "Test Anime (2025)", "x-jat",
+					"main", "Test Anime",
+				},
+			},
+		},
+		{
+			name: "added title",
+			prev: &base,
+			curr: &extended,
+			want: []changeSummary{
+				{models.TitleAdded, "Testing", "en", "official", ""},
+			},
+		},
+		{
+			name: "removed title",
+			prev: &extended,
+			curr: &base,
+			want: []changeSummary{
+				{models.TitleRemoved, "Testing", "en", "official", ""},
+			},
+		},
+		{
+			name: "duplicate titles added",
+			prev: &base,
+			curr: &duplicated,
+			want: []changeSummary{
+				{models.TitleAdded, "TA", "en", "syn", ""},
+				{models.TitleAdded, "TA", "en", "syn", ""},
+			},
+		},
+		{
+			name: "one of duplicate titles removed",
+			prev: &duplicated,
+			curr: &deduplicated,
+			want: []changeSummary{
+				{models.TitleRemoved, "TA", "en", "syn", ""},
+			},
+		},
+		{name: "neither", want: []changeSummary{}},
+	}
+	at := time.Date(2025, 7, 27, 2, 0, 0, 0, time.UTC)
+	for _, c := range cases {
+		changes := TitleChanges(c.prev, c.curr, at)
+		if got := summarise(changes); !slices.Equal(got, c.want) {
+			t.Errorf("%s: got changes %v, want %v", c.name, got, c.want)
+		}
+
+		ids := make(map[string]bool, len(changes))
+		for _, change := range changes {
+			if ids[change.Id] {
+				t.Errorf("%s: duplicate change id %s", c.name, change.Id)
+			}
+			ids[change.Id] = true
+			if change.Aid != "1" || !change.ChangedAt.Equal(at) {
+				t.Errorf("%s: got change %+v", c.name, change)
+			}
+		}
+	}
+}
+
+func TestTitleChangesIds(t *testing.T) {
+	prev := models.AnimeDocument{
+		Aid: "1", MainTitle: "Test Anime", MainTitleLang: "x-jat",
+	}
+	curr := prev
+	curr.MainTitle = "Test Anime (2025)"
+	at := time.Date(2025, 7, 27, 2, 0, 0, 0, time.UTC)
+
+	first := TitleChanges(&prev, &curr, at)
+	retried := TitleChanges(&prev, &curr, at.Add(time.Hour))
+	if first[0].Id != retried[0].Id {
+		t.Errorf(
+			"retried import changed the id from %s to %s",
+			first[0].Id, retried[0].Id,
+		)
+	}
+
+	reverted := TitleChanges(&curr, &prev, at)
+	if reverted[0].Id == first[0].Id {
+		t.Errorf("renaming back reused the id %s", first[0].Id)
+	}
+}
+
+func TestAnimeDiffer(t *testing.T) {
+	unchanged := models.AnimeDocument{Aid: "1", MainTitle: "A"}
+	modified := models.AnimeDocument{Aid: "2", MainTitle: "B"}
+	removed := models.AnimeDocument{Aid: "3", MainTitle: "C"}
+	added := models.AnimeDocument{Aid: "4", MainTitle: "D"}
+
+	prevHashes := map[string]string{
+		"1": unchanged.Hash(),
+		"2": modified.Hash(),
+		"3": removed.Hash(),
+	}
+	d := NewAnimeDiffer(prevHashes)
+
+	modified.MainTitle = "B (2025)"
+	docs := []struct {
+		doc     models.AnimeDocument
+		changed bool
+	}{
+		{unchanged, false},
+		{modified, true},
+		{added, true},
+	}
+	for _, c := range docs {
+		if changed := d.Add(c.doc); changed != c.changed {
+			t.Errorf("Add(%s) = %t, want %t", c.doc.Aid, changed, c.changed)
+		}
+	}
+
+	// Diff may be called more than once without repeating removals
+	d.Diff()
+	diff := d.Diff()
+	got := map[string][]string{
+		"added":    diff.Added,
+		"modified": diff.Modified,
+		"removed":  diff.Removed,
+	}
+	want := map[string][]string{
+		"added":    {"4"},
+		"modified": {"2"},
+		"removed":  {"3"},
+	}
+	if !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got diff %v, want %v", got, want)
+	}
+}
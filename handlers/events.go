@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"michiru/models"
+)
+
+// eventBuffer is the number of events buffered per subscriber. Events are
+// dropped for subscribers which fall further behind.
+const eventBuffer = 64
+
+// eventHeartbeat is how often a comment is sent to idle event streams, so that
+// proxies do not close them.
+const eventHeartbeat = 30 * time.Second
+
+// EventBroker fans out import events to all subscribers.
+type EventBroker struct {
+	// Maximum number of subscribers, 0 for no limit
+	limit int
+
+	mu     sync.Mutex
+	subs   map[chan models.ImportEvent]struct{}
+	closed bool
+}
+
+// NewEventBroker returns a broker accepting up to limit subscribers at once.
+// A limit of 0 or less disables it.
+func NewEventBroker(limit int) *EventBroker {
+	return &EventBroker{
+		limit: limit,
+		subs:  make(map[chan models.ImportEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving all events published from now on, and
+// a function to unsubscribe. The channel is closed once the broker is closed.
+// If the broker already has its maximum number of subscribers, ok is false.
+func (b *EventBroker) Subscribe() (
+	events <-chan models.ImportEvent, unsubscribe func(), ok bool,
+) {
+	ch := make(chan models.ImportEvent, eventBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+	} else if b.limit > 0 && len(b.subs) >= b.limit {
+		return nil, nil, false
+	} else {
+		b.subs[ch] = struct{}{}
+	}
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}, true
+}
+
+// Close closes the channels of all subscribers, ending their event streams so
+// that the server can shut down.
+func (b *EventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		close(ch)
+		delete(b.subs, ch)
+	}
+}
+
+// Publish sends event to all subscribers without blocking.
+func (b *EventBroker) Publish(event models.ImportEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// HandleEvents streams import events as server-sent events, named after the
+// event type with the JSON encoded event as data.
+func HandleEvents(broker *EventBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		events, unsubscribe, ok := broker.Subscribe()
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			writeError(
+				w, "too many event streams", http.StatusServiceUnavailable,
+			)
+			return
+		}
+		defer unsubscribe()
+
+		rc := http.NewResponseController(w)
+		// Streams are long-lived, so must not be cut off by write timeouts
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			slog.ErrorContext(
+				r.Context(), "Could not flush event stream", "error", err,
+			)
+			return
+		}
+
+		heartbeat := time.NewTicker(eventHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					slog.ErrorContext(
+						r.Context(), "Could not encode event", "error", err,
+					)
+					continue
+				}
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				if err != nil {
+					return
+				}
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -3,89 +3,144 @@ package handlers
 import (
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync/atomic"
 
 	"michiru/config"
+	"michiru/internal/tracing"
+	"michiru/models"
 )
 
-func FetchDump(ctx context.Context, cfg config.Config) ([]byte, error) {
+// ErrNotModified is returned by FetchDump when the title dump has not changed
+// since the previous import.
+var ErrNotModified = errors.New("title dump not modified")
+
+// DumpReader decompresses a title dump as it is read, closing the underlying
+// source along with it.
+type DumpReader struct {
+	*gzip.Reader
+	src        io.Closer
+	compressed *byteCounter
+}
+
+func newDumpReader(src io.ReadCloser) (*DumpReader, error) {
+	counter := &byteCounter{r: src}
+	zr, err := gzip.NewReader(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DumpReader{Reader: zr, src: src, compressed: counter}, nil
+}
+
+func (dr *DumpReader) Close() error {
+	return errors.Join(dr.Reader.Close(), dr.src.Close())
+}
+
+// BytesRead returns the number of compressed bytes read from the source so far.
+func (dr *DumpReader) BytesRead() int64 {
+	return dr.compressed.n.Load()
+}
+
+// byteCounter counts the bytes read through it. It may be read from
+// concurrently with the reads.
+type byteCounter struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (bc *byteCounter) Read(p []byte) (int, error) {
+	n, err := bc.r.Read(p)
+	bc.n.Add(int64(n))
+	return n, err
+}
+
+// FetchDump opens a stream of the decompressed title dump. If pastMeta holds
+// cache validators from a previous import, a conditional request is made and
+// ErrNotModified is returned if the dump is unchanged.
+// The caller is responsible for closing the returned reader.
+func FetchDump(
+	ctx context.Context, cfg config.Config, pastMeta *models.MetadataDocument,
+) (*DumpReader, *models.DumpValidators, error) {
 	url := cfg.TitleDumpURL
 
-	logger.Println("Fetching dump from ", url)
+	slog.InfoContext(ctx, "Fetching dump", "url", url)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, nil, fmt.Errorf("creating request: %w", err)
 	}
-	req.Header.Add("Cache-Control", "no-cache")
 	req.Header.Add("User-Agent", "go-http")
+	if pastMeta != nil && pastMeta.ETag != "" {
+		req.Header.Add("If-None-Match", pastMeta.ETag)
+	}
+	if pastMeta != nil && pastMeta.LastModified != "" {
+		req.Header.Add("If-Modified-Since", pastMeta.LastModified)
+	}
 
-	client := &http.Client{Timeout: cfg.FetchTimeout}
+	// The timeout only covers receiving the response headers, as the body is
+	// read while the index is updated, which may take much longer
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = cfg.FetchTimeout
+	client := &http.Client{Transport: tracing.Transport(transport)}
 	res, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetching title dump: %w", err)
+		return nil, nil, fmt.Errorf("fetching title dump: %w", err)
 	}
-	defer func(res *http.Response) {
+
+	if res.StatusCode != http.StatusOK {
 		cerr := res.Body.Close()
 		if cerr != nil {
-			logger.Println("warn: ", cerr)
+			slog.WarnContext(ctx, "Could not close dump", "error", cerr)
 		}
-	}(res)
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fetching title dump: %w", err)
+		if res.StatusCode == http.StatusNotModified {
+			return nil, nil, ErrNotModified
+		}
+		return nil, nil, fmt.Errorf(
+			"fetching title dump: unexpected status %s", res.Status,
+		)
 	}
 
-	zr, err := gzip.NewReader(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("decompressing dump: %w", err)
+	validators := &models.DumpValidators{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
 	}
-	defer func(zr *gzip.Reader) {
-		cerr := zr.Close()
-		if cerr != nil {
-			logger.Println("warn: ", cerr)
-		}
-	}(zr)
 
-	b, err := io.ReadAll(zr)
+	dump, err := newDumpReader(res.Body)
 	if err != nil {
-		return nil, fmt.Errorf("reading dump file: %w", err)
+		cerr := res.Body.Close()
+		if cerr != nil {
+			slog.WarnContext(ctx, "Could not close dump", "error", cerr)
+		}
+		return nil, nil, fmt.Errorf("decompressing dump: %w", err)
 	}
 
-	return b, nil
+	return dump, validators, nil
 }
 
-func FetchDumpMock(ctx context.Context, cfg config.Config) ([]byte, error) {
-	logger.Println("Reading dump from", "anime-titles.xml.gz")
+func FetchDumpMock(
+	ctx context.Context, cfg config.Config, pastMeta *models.MetadataDocument,
+) (*DumpReader, *models.DumpValidators, error) {
+	slog.InfoContext(ctx, "Reading dump", "path", "anime-titles.xml.gz")
 	file, err := os.Open("anime-titles.xml.gz")
 	if err != nil {
-		return nil, fmt.Errorf("opening dump file: %w", err)
+		return nil, nil, fmt.Errorf("opening dump file: %w", err)
 	}
-	defer func(file *os.File) {
-		cerr := file.Close()
-		if cerr != nil {
-			logger.Println("warn: ", err)
-		}
-	}(file)
 
-	zr, err := gzip.NewReader(file)
+	dump, err := newDumpReader(file)
 	if err != nil {
-		return nil, fmt.Errorf("decompressing dump: %w", err)
-	}
-	defer func(zr *gzip.Reader) {
-		cerr := zr.Close()
+		cerr := file.Close()
 		if cerr != nil {
-			logger.Println("warn: ", err)
+			slog.WarnContext(ctx, "Could not close dump", "error", cerr)
 		}
-	}(zr)
-
-	b, err := io.ReadAll(zr)
-	if err != nil {
-		return nil, fmt.Errorf("reading dump file: %w", err)
+		return nil, nil, fmt.Errorf("decompressing dump: %w", err)
 	}
 
-	return b, nil
+	return dump, &models.DumpValidators{}, nil
 }
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"michiru/config"
+	"michiru/internal/clients"
+	"michiru/models"
+)
+
+// readyTimeout bounds each readiness check, so a hanging backend fails the
+// check instead of the probe timing out.
+const readyTimeout = 5 * time.Second
+
+// HandleHealthz reports that the process is alive and serving requests.
+func HandleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+
+		err := json.NewEncoder(w).Encode(
+			models.HealthResponse{Status: models.CheckOk},
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+// HandleReadyz reports whether the server can serve searches: the backend is
+// reachable, the index holds anime, and the last import retrieved the dump
+// within cfg.ReadyMaxStaleness. Responds with 503 if any check fails.
+func HandleReadyz(
+	cfg config.Config, backend clients.SearchBackend,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]models.HealthCheck{
+			"backend": runCheck(r.Context(), backend.Ping),
+			"index": runCheck(
+				r.Context(), func(ctx context.Context) error {
+					count, err := backend.CountAnime(ctx)
+					if err != nil {
+						return err
+					}
+					if count == 0 {
+						return errors.New("index is empty")
+					}
+					return nil
+				},
+			),
+		}
+		if cfg.ReadyMaxStaleness > 0 {
+			checks["freshness"] = runCheck(
+				r.Context(), func(ctx context.Context) error {
+					return checkFreshness(ctx, backend, cfg.ReadyMaxStaleness)
+				},
+			)
+		}
+
+		resp := models.HealthResponse{Status: models.CheckOk, Checks: checks}
+		code := http.StatusOK
+		for _, check := range checks {
+			if check.Status != models.CheckOk {
+				resp.Status = models.CheckFailed
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+
+		err := json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+}
+
+// runCheck runs check with readyTimeout and records its result.
+func runCheck(
+	ctx context.Context, check func(ctx context.Context) error,
+) models.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+
+	result := models.HealthCheck{
+		Status:     models.CheckOk,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = models.CheckFailed
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkFreshness fails if the title dump was last retrieved more than maxAge ago.
+func checkFreshness(
+	ctx context.Context, backend clients.SearchBackend, maxAge time.Duration,
+) error {
+	meta, err := backend.GetMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return errors.New("no import has completed yet")
+	}
+
+	age := time.Since(meta.RetrievedAt)
+	if age > maxAge {
+		return fmt.Errorf(
+			"title dump was last retrieved %s ago at %s, exceeding %s",
+			age.Truncate(time.Second), meta.RetrievedAt.Format(time.RFC3339),
+			maxAge,
+		)
+	}
+	return nil
+}
+
+// Probe requests url and fails unless it responds with 200, for container
+// health checks on images without an HTTP client.
+func Probe(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*readyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", url, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"michiru/config"
+	"michiru/internal/clients"
+	"michiru/internal/logging"
+	"michiru/internal/metrics"
+	"michiru/models"
+)
+
+// ErrInvalidDump is returned by RunImport when the title dump fails to parse or
+// validate, in which case retrying the import is unlikely to help.
+var ErrInvalidDump = errors.New("invalid title dump")
+
+// progressInterval is the number of anime parsed between progress events.
+const progressInterval = 1000
+
+var tracer = otel.Tracer("michiru/handlers")
+
+// RunImport fetches the title dump and imports it into the search backend,
+// either rebuilding the whole index or applying only the anime which changed
+// since the last import. Progress is recorded in job, but its final state is
+// left to the caller, as a failed import may be retried.
+// A report of every run is added to the import history of the backend.
+func RunImport(
+	ctx context.Context, cfg config.Config, backend clients.SearchBackend,
+	job *ImportJob,
+) error {
+	ctx = logging.WithAttrs(ctx, slog.String("job_id", job.Id()))
+	ctx, span := tracer.Start(
+		ctx, "RunImport", trace.WithAttributes(
+			attribute.String("import.job_id", job.Id()),
+			attribute.String("import.trigger", job.Trigger()),
+			attribute.Bool("import.force", job.Force()),
+		),
+	)
+	defer span.End()
+
+	report := models.ImportReport{
+		Id:        newId(),
+		JobId:     job.Id(),
+		Trigger:   job.Trigger(),
+		StartedAt: time.Now().UTC(),
+		SourceURL: cfg.TitleDumpURL,
+	}
+
+	meta, diff, err := runImport(ctx, cfg, backend, job, &report)
+
+	report.EndedAt = time.Now().UTC()
+	switch {
+	case err == nil && report.Outcome == "":
+		report.Outcome = models.OutcomeSucceeded
+	case errors.Is(err, ErrImportTooSoon):
+		report.Outcome = models.OutcomeSkipped
+		report.Error = err.Error()
+	case err != nil:
+		report.Outcome = models.OutcomeFailed
+		report.Error = err.Error()
+	}
+	metrics.ObserveImport(report)
+	logImport(ctx, report)
+	span.SetAttributes(
+		attribute.String("import.report_id", report.Id),
+		attribute.String("import.outcome", report.Outcome),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	// Notify webhooks of imports which changed the index or failed, as those
+	// skipped or not modified leave cached results valid
+	if report.Outcome == models.OutcomeSucceeded ||
+		report.Outcome == models.OutcomeFailed {
+		payload := models.WebhookPayload{
+			Event:    models.EventImport,
+			ReportId: report.Id,
+			Outcome:  report.Outcome,
+			Metadata: meta,
+			Added:    make([]string, 0),
+			Changed:  make([]string, 0),
+			Removed:  make([]string, 0),
+			Error:    report.Error,
+		}
+		if diff != nil {
+			payload.Added = diff.Added
+			payload.Changed = diff.Modified
+			payload.Removed = diff.Removed
+		}
+		report.Deliveries = SendWebhooks(
+			context.WithoutCancel(ctx), cfg, payload,
+		)
+	}
+
+	job.emit(models.ImportEvent{Type: models.EventSummary, Report: &report})
+
+	// Record failures even if the import was cancelled
+	rerr := backend.AddImportReport(context.WithoutCancel(ctx), report)
+	if rerr != nil {
+		slog.ErrorContext(ctx, "Could not add import report", "error", rerr)
+	}
+
+	return err
+}
+
+// runImport runs the import pipeline for RunImport, filling in report. The
+// new metadata and diff are returned once the dump has been parsed, even if
+// the import then fails.
+func runImport(
+	ctx context.Context, cfg config.Config, backend clients.SearchBackend,
+	job *ImportJob, report *models.ImportReport,
+) (*models.MetadataDocument, *models.AnimeDiff, error) {
+	base := clients.WithTaskObserver(
+		ctx, func(uid int64, taskType string, status string) {
+			job.emit(
+				models.ImportEvent{
+					Type:       models.EventTask,
+					TaskUid:    &uid,
+					TaskType:   taskType,
+					TaskStatus: status,
+				},
+			)
+		},
+	)
+	phase := importPhase{job: job}
+	defer phase.end()
+
+	ctx = phase.enter(base, models.ImportChecking)
+
+	// Initialise indexes if they don't exist
+	if err := backend.Init(ctx); err != nil {
+		return nil, nil, fmt.Errorf("initialising search backend: %w", err)
+	}
+
+	pastMeta, err := backend.GetMetadata(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting metadata: %w", err)
+	}
+
+	if job.Force() {
+		// Also skip the conditional request, as the dump is refetched on purpose
+		pastMeta = nil
+	} else if job.Trigger() != models.TriggerSchedule {
+		// The scheduler spaces out its imports itself, and its jitter would
+		// otherwise make runs fail whenever they start earlier than the last
+		err = ValidateImportInterval(pastMeta, cfg.ImportInterval)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"validating import interval: %w", err,
+			)
+		}
+	}
+
+	ctx = phase.enter(base, models.ImportFetching)
+	dump, validators, err := FetchDump(ctx, cfg, pastMeta)
+	if errors.Is(err, ErrNotModified) {
+		slog.InfoContext(
+			ctx, "Title dump not modified since last import, nothing to do",
+		)
+		report.Outcome = models.OutcomeNotModified
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching title dump: %w", err)
+	}
+	defer func() {
+		report.ByteSize = dump.BytesRead()
+		if cerr := dump.Close(); cerr != nil {
+			slog.WarnContext(ctx, "Could not close dump", "error", cerr)
+		}
+	}()
+
+	validator, err := NewDumpValidator(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("initialising validator: %w", err)
+	}
+	defer validator.Free()
+
+	prevHashes, err := backend.GetAnimeHashes(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting anime hashes: %w", err)
+	}
+
+	// Without any stored hashes, rebuild the whole index instead of diffing
+	var staging clients.StagingIndex
+	if len(prevHashes) == 0 {
+		staging, err = backend.NewStagingIndex(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer staging.Discard()
+	}
+
+	ctx = phase.enter(base, models.ImportParsing)
+
+	// Changed anime are few enough between imports to hold until the dump is
+	// fully parsed, so a bad dump never partially updates the index
+	differ := NewAnimeDiffer(prevHashes)
+	upserts := make([]models.AnimeDocument, 0)
+	var stagingErr error
+	var validated, parsed int64
+	emitProgress := func() {
+		job.emit(
+			models.ImportEvent{
+				Type: models.EventFetch, BytesRead: dump.BytesRead(),
+			},
+		)
+		job.emit(models.ImportEvent{Type: models.EventValidate, Anime: validated})
+		job.emit(models.ImportEvent{Type: models.EventParse, Anime: parsed})
+	}
+	validate := func(anime []byte) error {
+		err := validator.Validate(anime)
+		if err == nil {
+			validated++
+		}
+		return err
+	}
+	meta, err := ParseDump(
+		dump, validate, func(doc models.AnimeDocument) error {
+			if parsed++; parsed%progressInterval == 0 {
+				emitProgress()
+			}
+
+			changed := differ.Add(doc)
+			if staging != nil {
+				stagingErr = staging.Add(doc)
+				return stagingErr
+			}
+			if changed {
+				upserts = append(upserts, doc)
+			}
+			return nil
+		},
+	)
+	emitProgress()
+	if stagingErr != nil {
+		return nil, nil, fmt.Errorf("adding anime: %w", stagingErr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"parsing title dump: %w: %w", ErrInvalidDump, err,
+		)
+	}
+	meta.DumpValidators = *validators
+	slog.InfoContext(
+		ctx, "Parsed title dump", "anime", meta.DumpEntries,
+		"titles", meta.DumpTitles, "bytes", dump.BytesRead(),
+	)
+
+	diff := differ.Diff()
+	meta.Added = int64(len(diff.Added))
+	meta.Modified = int64(len(diff.Modified))
+	meta.Removed = int64(len(diff.Removed))
+
+	updatedAt := meta.UpdatedAt
+	report.UpdatedAt = &updatedAt
+	report.DumpEntries = meta.DumpEntries
+	report.DumpTitles = meta.DumpTitles
+	report.Added = meta.Added
+	report.Modified = meta.Modified
+	report.Removed = meta.Removed
+	slog.InfoContext(
+		ctx, "Computed import diff", "added", meta.Added,
+		"modified", meta.Modified, "removed", meta.Removed,
+	)
+
+	ctx = phase.enter(base, models.ImportIndexing)
+	if staging != nil {
+		// Without previous versions of the anime, no title changes are
+		// recorded, so the first import is the baseline of the change log
+		if err = staging.Commit(meta); err != nil {
+			return meta, diff, fmt.Errorf("adding anime: %w", err)
+		}
+	} else {
+		// Keep the previous versions of changed anime to record title changes
+		prevAnime, err := getAnime(
+			ctx, backend, slices.Concat(diff.Modified, diff.Removed),
+			cfg.ImportBatchSize,
+		)
+		if err != nil {
+			return meta, diff, fmt.Errorf("getting previous anime: %w", err)
+		}
+
+		changes := make([]models.TitleChange, 0)
+		for _, doc := range upserts {
+			var prev *models.AnimeDocument
+			if prevDoc, ok := prevAnime[doc.Aid.String()]; ok {
+				prev = &prevDoc
+			}
+			changes = append(
+				changes, TitleChanges(prev, &doc, meta.RetrievedAt)...,
+			)
+		}
+		for _, aid := range diff.Removed {
+			if prevDoc, ok := prevAnime[aid]; ok {
+				changes = append(
+					changes, TitleChanges(&prevDoc, nil, meta.RetrievedAt)...,
+				)
+			}
+		}
+
+		if err = backend.AddTitleChanges(ctx, changes); err != nil {
+			return meta, diff, fmt.Errorf("recording title changes: %w", err)
+		}
+		slog.InfoContext(
+			ctx, "Recorded title changes", "title_changes", len(changes),
+		)
+
+		// The hashes the next diff is computed from are only updated once
+		// the changes are stored, so that failed imports do not lose them
+		err = backend.UpdateAnime(ctx, upserts, diff.Removed, meta)
+		if err != nil {
+			return meta, diff, fmt.Errorf("updating anime: %w", err)
+		}
+	}
+
+	if err = backend.UpdateMetadata(ctx, meta); err != nil {
+		return meta, diff, fmt.Errorf("updating metadata: %w", err)
+	}
+
+	return meta, diff, nil
+}
+
+// importPhase tracks the current phase of an import, which is traced as a span
+// and tagged on everything logged during it.
+type importPhase struct {
+	job  *ImportJob
+	span trace.Span
+}
+
+// enter ends the current phase and moves the job to state, returning a child
+// context of ctx for the new phase.
+func (p *importPhase) enter(ctx context.Context, state string) context.Context {
+	p.end()
+	p.job.setState(state, nil)
+
+	ctx, p.span = tracer.Start(ctx, "import."+state)
+	return logging.WithAttrs(ctx, slog.String("phase", state))
+}
+
+// end ends the span of the current phase, if any.
+func (p *importPhase) end() {
+	if p.span != nil {
+		p.span.End()
+		p.span = nil
+	}
+}
+
+// logImport logs the outcome of an import run along with its counts.
+func logImport(ctx context.Context, report models.ImportReport) {
+	level := slog.LevelInfo
+	if report.Outcome == models.OutcomeFailed {
+		level = slog.LevelError
+	}
+
+	attrs := []slog.Attr{
+		slog.String("report_id", report.Id),
+		slog.String("trigger", report.Trigger),
+		slog.String("outcome", report.Outcome),
+		slog.Int64(
+			"duration_ms", report.EndedAt.Sub(report.StartedAt).Milliseconds(),
+		),
+		slog.Int64("bytes", report.ByteSize),
+		slog.Int64("dump_entries", report.DumpEntries),
+		slog.Int64("dump_titles", report.DumpTitles),
+		slog.Int64("added", report.Added),
+		slog.Int64("modified", report.Modified),
+		slog.Int64("removed", report.Removed),
+	}
+	if report.Error != "" {
+		attrs = append(attrs, slog.String("error", report.Error))
+	}
+
+	slog.LogAttrs(ctx, level, "Import finished", attrs...)
+}
+
+// getAnime returns the anime with the given aids keyed by aid, looking them up
+// in batches of batchSize.
+func getAnime(
+	ctx context.Context, backend clients.SearchBackend, aids []string,
+	batchSize int,
+) (map[string]models.AnimeDocument, error) {
+	anime := make(map[string]models.AnimeDocument, len(aids))
+	for batch := range slices.Chunk(aids, max(batchSize, 1)) {
+		docs, err := backend.GetAnimeBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(anime, docs)
+	}
+
+	return anime, nil
+}
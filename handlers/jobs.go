@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"michiru/config"
+	"michiru/internal/clients"
+	"michiru/models"
+)
+
+// ErrImportRunning is returned when an import is requested while another
+// import is still running.
+var ErrImportRunning = errors.New("an import is already running")
+
+// maxImportJobs is the number of finished import jobs kept by an ImportRunner.
+const maxImportJobs = 50
+
+// ImportJob tracks the state of a single import, and is safe for concurrent use.
+type ImportJob struct {
+	mu   sync.Mutex
+	info models.ImportJob
+	// Receives the progress of the job, if set
+	events *EventBroker
+}
+
+func NewImportJob(trigger string, force bool) *ImportJob {
+	now := time.Now().UTC()
+	return &ImportJob{
+		info: models.ImportJob{
+			Id:       newId(),
+			State:    models.ImportQueued,
+			Trigger:  trigger,
+			Force:    force,
+			QueuedAt: now,
+			Phases: []models.ImportPhase{
+				{State: models.ImportQueued, StartedAt: now},
+			},
+		},
+	}
+}
+
+func (j *ImportJob) Id() string {
+	return j.info.Id
+}
+
+func (j *ImportJob) Trigger() string {
+	return j.info.Trigger
+}
+
+func (j *ImportJob) Force() bool {
+	return j.info.Force
+}
+
+// Info returns a snapshot of the job.
+func (j *ImportJob) Info() models.ImportJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := j.info
+	info.Phases = slices.Clone(j.info.Phases)
+	return info
+}
+
+// emit publishes an event of the job, if it has an event broker.
+func (j *ImportJob) emit(event models.ImportEvent) {
+	if j.events == nil {
+		return
+	}
+
+	event.JobId = j.info.Id
+	event.Time = time.Now().UTC()
+	j.events.Publish(event)
+}
+
+// setState ends the current phase of the job and starts the next. The final
+// states done and failed do not start a new phase.
+func (j *ImportJob) setState(state string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now().UTC()
+	if n := len(j.info.Phases); n > 0 && j.info.Phases[n-1].EndedAt == nil {
+		phase := &j.info.Phases[n-1]
+		phase.EndedAt = &now
+		phase.DurationMs = now.Sub(phase.StartedAt).Milliseconds()
+		slog.Info(
+			"Import phase ended", "job_id", j.info.Id, "phase", phase.State,
+			"duration_ms", phase.DurationMs,
+		)
+	}
+
+	defer j.emit(models.ImportEvent{Type: models.EventState, State: state})
+
+	j.info.State = state
+	switch state {
+	case models.ImportDone, models.ImportFailed:
+		j.info.FinishedAt = &now
+		if err != nil {
+			j.info.Error = err.Error()
+		}
+	default:
+		j.info.Phases = append(
+			j.info.Phases, models.ImportPhase{State: state, StartedAt: now},
+		)
+	}
+}
+
+func (j *ImportJob) addAttempt() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.info.Attempts++
+}
+
+// newId returns a random identifier for import jobs and reports.
+func newId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ImportRunner runs import jobs one at a time, retrying failed imports with
+// exponential backoff, and keeps a record of recent jobs.
+type ImportRunner struct {
+	// Jobs started in the background run until this is cancelled
+	ctx     context.Context
+	cfg     config.Config
+	backend clients.SearchBackend
+	events  *EventBroker
+
+	mu     sync.Mutex
+	active *ImportJob
+	jobs   []*ImportJob
+}
+
+// NewImportRunner returns an ImportRunner publishing the progress of its jobs
+// to events. Jobs started in the background are cancelled along with ctx, which
+// should last as long as the process.
+func NewImportRunner(
+	ctx context.Context, cfg config.Config, backend clients.SearchBackend,
+	events *EventBroker,
+) *ImportRunner {
+	return &ImportRunner{
+		ctx:     ctx,
+		cfg:     cfg,
+		backend: backend,
+		events:  events,
+		jobs:    make([]*ImportJob, 0),
+	}
+}
+
+// Start queues an import job and runs it in the background, independently of
+// the caller, until the context of the runner is cancelled. ErrImportRunning
+// is returned along with the active job if an import is already running.
+func (r *ImportRunner) Start(trigger string, force bool) (*ImportJob, error) {
+	job, err := r.queue(trigger, force)
+	if err != nil {
+		return job, err
+	}
+
+	go func() {
+		if err := r.run(r.ctx, job); err != nil {
+			slog.Error("Import failed", "job_id", job.Id(), "error", err)
+		}
+	}()
+	return job, nil
+}
+
+// Run runs an import job to completion. ErrImportRunning is returned if an
+// import is already running.
+func (r *ImportRunner) Run(
+	ctx context.Context, trigger string, force bool,
+) (*ImportJob, error) {
+	job, err := r.queue(trigger, force)
+	if err != nil {
+		return job, err
+	}
+	return job, r.run(ctx, job)
+}
+
+// Events returns the broker receiving the progress of all jobs.
+func (r *ImportRunner) Events() *EventBroker {
+	return r.events
+}
+
+// Job returns the job with the given id, or nil if it is unknown.
+func (r *ImportRunner) Job(id string) *ImportJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, job := range r.jobs {
+		if job.Id() == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// Jobs returns snapshots of all known jobs, most recent first.
+func (r *ImportRunner) Jobs() []models.ImportJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobs := make([]models.ImportJob, 0, len(r.jobs))
+	for i := len(r.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, r.jobs[i].Info())
+	}
+	return jobs
+}
+
+func (r *ImportRunner) queue(trigger string, force bool) (*ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active != nil {
+		return r.active, ErrImportRunning
+	}
+
+	job := NewImportJob(trigger, force)
+	job.events = r.events
+	r.active = job
+	r.jobs = append(r.jobs, job)
+	if len(r.jobs) > maxImportJobs {
+		r.jobs = r.jobs[len(r.jobs)-maxImportJobs:]
+	}
+
+	return job, nil
+}
+
+// run runs the active job, retrying up to cfg.ImportRetries times.
+func (r *ImportRunner) run(ctx context.Context, job *ImportJob) error {
+	defer func() {
+		r.mu.Lock()
+		r.active = nil
+		r.mu.Unlock()
+	}()
+
+	backoff := r.cfg.ImportRetryBackoff
+	for attempt := 0; ; attempt++ {
+		job.addAttempt()
+		err := RunImport(ctx, r.cfg, r.backend, job)
+		if err == nil {
+			job.setState(models.ImportDone, nil)
+			return nil
+		}
+		if !retryable(err) || attempt >= r.cfg.ImportRetries {
+			job.setState(models.ImportFailed, err)
+			return err
+		}
+
+		slog.Warn(
+			"Import failed, retrying", "job_id", job.Id(),
+			"attempt", attempt+1, "backoff", backoff, "error", err,
+		)
+		job.setState(models.ImportQueued, nil)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = errors.Join(err, ctx.Err())
+			job.setState(models.ImportFailed, err)
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether an import which failed with err may succeed if
+// run again, which is the case for fetch and search backend failures.
+func retryable(err error) bool {
+	return !errors.Is(err, ErrImportTooSoon) &&
+		!errors.Is(err, ErrInvalidDump) &&
+		!errors.Is(err, context.Canceled)
+}
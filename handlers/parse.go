@@ -1,10 +1,11 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/xml"
+	"fmt"
 	"io"
-	"log"
 	"regexp"
 	"strconv"
 	"time"
@@ -12,39 +13,109 @@ import (
 	"michiru/models"
 )
 
-func ParseDump(b []byte) ([]models.AnimeDocument, *models.MetadataDocument, error) {
+var dumpCommentRegexp = regexp.MustCompile(`: (.*) \((\d*)\D*(\d*)`)
+
+// recordingReader keeps the bytes read from a stream since the last discard,
+// so the raw XML of a decoded element can be recovered.
+// It implements io.ByteReader, which stops xml.Decoder from buffering ahead of
+// its reported input offset.
+type recordingReader struct {
+	r    *bufio.Reader
+	buf  bytes.Buffer
+	base int64
+}
+
+func newRecordingReader(r io.Reader) *recordingReader {
+	return &recordingReader{r: bufio.NewReader(r)}
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf.Write(p[:n])
+	return n, err
+}
+
+func (rr *recordingReader) ReadByte() (byte, error) {
+	b, err := rr.r.ReadByte()
+	if err == nil {
+		rr.buf.WriteByte(b)
+	}
+	return b, err
+}
+
+// discard drops all recorded bytes before the stream offset off.
+func (rr *recordingReader) discard(off int64) {
+	rr.buf.Next(int(off - rr.base))
+	rr.base = off
+}
+
+// recorded returns the recorded bytes up to the stream offset off.
+func (rr *recordingReader) recorded(off int64) []byte {
+	return rr.buf.Bytes()[:off-rr.base]
+}
+
+// ParseDump decodes the title dump from r as a stream, calling validate with the
+// raw XML of each anime element and handle with its converted document.
+// Only a single anime element is held in memory at a time. Malformed or invalid
+// elements fail the parse, as skipping them would remove their anime.
+func ParseDump(
+	r io.Reader, validate func([]byte) error,
+	handle func(models.AnimeDocument) error,
+) (*models.MetadataDocument, error) {
 	var meta models.MetadataDocument
 	meta.RetrievedAt = time.Now().UTC().Truncate(time.Second)
 
-	anime := make([]models.AnimeXMLItem, 0)
-	r := bytes.NewReader(b)
-	d := xml.NewDecoder(r)
+	rr := newRecordingReader(r)
+	d := xml.NewDecoder(rr)
+	seenRoot := false
 	for {
+		rr.discard(d.InputOffset())
+
 		token, err := d.Token()
 		if token == nil || err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		switch t := token.(type) {
 		case xml.StartElement:
+			if !seenRoot {
+				if t.Name.Local != "animetitles" {
+					return nil, fmt.Errorf(
+						"unexpected root element %s", t.Name.Local,
+					)
+				}
+				seenRoot = true
+				continue
+			}
+
 			if t.Name.Local == "anime" {
+				aid := attrValue(t, "aid")
+				if err := d.Skip(); err != nil {
+					return nil, fmt.Errorf("malformed anime %q: %w", aid, err)
+				}
+
+				// The raw element is validated before it is converted, so
+				// that nothing invalid is silently dropped
+				raw := rr.recorded(d.InputOffset())
+				if err := validate(raw); err != nil {
+					return nil, fmt.Errorf("invalid anime %q: %w", aid, err)
+				}
 				var a models.AnimeXMLItem
-				if err := d.DecodeElement(&a, &t); err != nil {
-					log.Printf("invalid formatting for XML item: %s", err)
-					continue
+				if err := xml.Unmarshal(raw, &a); err != nil {
+					return nil, fmt.Errorf("invalid anime %q: %w", aid, err)
+				}
+				if err := handle(a.ToDocument()); err != nil {
+					return nil, err
 				}
-				anime = append(anime, a)
 			}
 		case xml.Comment:
-			re, err := regexp.Compile(`: (.*) \((\d*)\D*(\d*)`)
-			if err != nil {
-				return nil, nil, err
+			groups := dumpCommentRegexp.FindSubmatch(t)
+			if groups == nil {
+				continue
 			}
 
-			groups := re.FindSubmatch(t)
-
 			datetime, _ := time.Parse("Mon Jan 2 15:04:05 2006", string(groups[1]))
 			meta.UpdatedAt = datetime.UTC()
 			entries, _ := strconv.ParseInt(string(groups[2]), 10, 0)
@@ -53,10 +124,16 @@ func ParseDump(b []byte) ([]models.AnimeDocument, *models.MetadataDocument, erro
 			meta.DumpTitles = titles
 		}
 	}
-	coll := make([]models.AnimeDocument, 0)
-	for _, item := range anime {
-		coll = append(coll, item.ToDocument())
-	}
 
-	return coll, &meta, nil
+	return &meta, nil
+}
+
+// attrValue returns the value of the attribute of el named name, if any.
+func attrValue(el xml.StartElement, name string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
 }
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"michiru/models"
+)
+
+// testDumpAnime are the anime elements of testDump, exactly as they appear in
+// it.
+var testDumpAnime = []string{
+	`<anime aid="1">
+		<title xml:lang="x-jat" type="main">Seikai no Monshou</title>
+		<title xml:lang="en" type="official">Crest of the Stars</title>
+		<title xml:lang="en" type="syn">CotS</title>
+	</anime>`,
+	`<anime aid="2">
+		<title xml:lang="x-jat" type="main">Cowboy Bebop</title>
+		<title xml:lang="ja" type="official">カウボーイビバップ</title>
+		<title xml:lang="en" type="short">CB</title>
+	</anime>`,
+}
+
+var testDump = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Created: Sun Jul 27 02:00:01 2025 (2 anime, 6 titles) -->
+<animetitles>
+	` + strings.Join(testDumpAnime, "\n\t") + `
+</animetitles>
+`
+
+// gzipReader returns a DumpReader decompressing dump, as fetched by FetchDump.
+func gzipReader(t *testing.T, dump string) *DumpReader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(dump)); err != nil {
+		t.Fatalf("compressing dump: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("compressing dump: %v", err)
+	}
+
+	dr, err := newDumpReader(io.NopCloser(&buf))
+	if err != nil {
+		t.Fatalf("newDumpReader: %v", err)
+	}
+	return dr
+}
+
+func TestParseDump(t *testing.T) {
+	dr := gzipReader(t, testDump)
+	defer dr.Close()
+
+	raws := make([]string, 0)
+	docs := make([]models.AnimeDocument, 0)
+	meta, err := ParseDump(
+		dr, func(raw []byte) error {
+			raws = append(raws, string(raw))
+			return StructuralValidator{}.Validate(raw)
+		}, func(doc models.AnimeDocument) error {
+			docs = append(docs, doc)
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("ParseDump: %v", err)
+	}
+
+	if !slices.Equal(raws, testDumpAnime) {
+		t.Errorf("got raw elements %q, want %q", raws, testDumpAnime)
+	}
+
+	want := []models.AnimeDocument{
+		{
+			Aid: "1", MainTitle: "Seikai no Monshou", MainTitleLang: "x-jat",
+			OfficialTitles:   map[string][]string{"en": {"Crest of the Stars"}},
+			SynonymousTitles: map[string][]string{"en": {"CotS"}},
+		},
+		{
+			Aid: "2", MainTitle: "Cowboy Bebop", MainTitleLang: "x-jat",
+			OfficialTitles: map[string][]string{"ja": {"カウボーイビバップ"}},
+			ShortTitles:    map[string][]string{"en": {"CB"}},
+		},
+	}
+	if len(docs) != len(want) {
+		t.Fatalf("got %d documents, want %d", len(docs), len(want))
+	}
+	for i := range want {
+		// Unused title maps are empty rather than nil, which Hash ignores
+		if docs[i].Hash() != want[i].Hash() {
+			t.Errorf("got document %+v, want %+v", docs[i], want[i])
+		}
+	}
+
+	updated := time.Date(2025, 7, 27, 2, 0, 1, 0, time.UTC)
+	if !meta.UpdatedAt.Equal(updated) || meta.DumpEntries != 2 ||
+		meta.DumpTitles != 6 {
+		t.Errorf(
+			"got updated %s, %d entries, %d titles, want %s, 2, 6",
+			meta.UpdatedAt, meta.DumpEntries, meta.DumpTitles, updated,
+		)
+	}
+}
+
+func TestParseDumpErrors(t *testing.T) {
+	errHandle := errors.New("handle failed")
+
+	cases := []struct {
+		name   string
+		dump   string
+		handle error
+		want   string
+	}{
+		{
+			name: "malformed element",
+			dump: `<animetitles>` + testDumpAnime[0] +
+				`<anime aid="2"><title xml:lang="en" type="main">A</anime>` +
+				`</animetitles>`,
+			want: `malformed anime "2"`,
+		},
+		{
+			name: "invalid element",
+			dump: `<animetitles>` +
+				`<anime aid="3"><title xml:lang="en" type="other">A</title></anime>` +
+				`</animetitles>`,
+			want: `invalid anime "3"`,
+		},
+		{
+			name: "unexpected root",
+			dump: `<titles>` + testDumpAnime[0] + `</titles>`,
+			want: "unexpected root element titles",
+		},
+		{
+			name:   "handler error",
+			dump:   testDump,
+			handle: errHandle,
+			want:   errHandle.Error(),
+		},
+	}
+	for _, c := range cases {
+		dr := gzipReader(t, c.dump)
+		_, err := ParseDump(
+			dr, StructuralValidator{}.Validate,
+			func(doc models.AnimeDocument) error {
+				return c.handle
+			},
+		)
+		dr.Close()
+
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestRecordingReader(t *testing.T) {
+	rr := newRecordingReader(strings.NewReader("abcdef"))
+
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(rr, buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if b, err := rr.ReadByte(); err != nil || b != 'd' {
+		t.Fatalf("ReadByte: got %q, %v", b, err)
+	}
+	if got := string(rr.recorded(4)); got != "abcd" {
+		t.Errorf("got recorded %q, want %q", got, "abcd")
+	}
+
+	rr.discard(2)
+	if got := string(rr.recorded(4)); got != "cd" {
+		t.Errorf("got recorded %q after discard, want %q", got, "cd")
+	}
+
+	rest, _ := io.ReadAll(rr)
+	if got := string(rr.recorded(6)); string(rest) != "ef" || got != "cdef" {
+		t.Errorf("got rest %q, recorded %q, want %q, %q", rest, got, "ef", "cdef")
+	}
+}
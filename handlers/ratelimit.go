@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"michiru/config"
+)
+
+// APIKeyHeader holds the API key of a request.
+const APIKeyHeader = "X-Api-Key"
+
+// How often the buckets of clients which have not made requests for long
+// enough to refill are removed.
+const sweepInterval = time.Minute
+
+// quota is the rate in requests per second at which the bucket of a client
+// refills, and the number of requests it holds. A rate of 0 is unlimited.
+type quota struct {
+	rate  float64
+	burst int
+}
+
+type bucket struct {
+	quota  quota
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accumulated since the bucket was last used.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(
+		float64(b.quota.burst),
+		b.tokens+now.Sub(b.last).Seconds()*b.quota.rate,
+	)
+	b.last = now
+}
+
+// RateLimiter authenticates API requests by key and limits each client to the
+// quota of its key with a token bucket. Clients without a key are identified
+// by IP, unless keys are required.
+type RateLimiter struct {
+	// Quotas by SHA-256 hash of the key, so lookups take the same time
+	// regardless of how much of a key is correct
+	keys     map[[sha256.Size]byte]quota
+	required bool
+	anon     quota
+	proxies  []netip.Prefix
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a limiter with the API keys, quotas and trusted
+// proxies of cfg, reading further keys from cfg.APIKeysFile if set.
+func NewRateLimiter(cfg config.Config) (*RateLimiter, error) {
+	if cfg.RateLimit < 0 {
+		return nil, errors.New("rate limit must not be negative")
+	}
+	if cfg.RateBurst < 1 {
+		return nil, errors.New("rate burst must be at least 1")
+	}
+
+	l := &RateLimiter{
+		keys:      make(map[[sha256.Size]byte]quota),
+		required:  cfg.APIKeyRequired,
+		anon:      quota{rate: cfg.RateLimit, burst: cfg.RateBurst},
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+
+	entries := slices.Clone(cfg.APIKeys)
+	if cfg.APIKeysFile != "" {
+		data, err := os.ReadFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading API keys file: %w", err)
+		}
+		for line := range strings.Lines(string(data)) {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+	}
+	for i, entry := range entries {
+		key, q, err := parseAPIKey(entry, l.anon)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API key %d: %w", i+1, err)
+		}
+		l.keys[sha256.Sum256([]byte(key))] = q
+	}
+	if l.required && len(l.keys) == 0 {
+		return nil, errors.New("API keys are required but none are configured")
+	}
+
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := parseProxy(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		l.proxies = append(l.proxies, prefix)
+	}
+
+	return l, nil
+}
+
+// parseAPIKey parses an entry of the form key, key:rate or key:rate:burst,
+// taking the parts of the quota which are omitted from def. Errors do not
+// include the key, as they are logged.
+func parseAPIKey(entry string, def quota) (string, quota, error) {
+	key, limits, hasRate := strings.Cut(entry, ":")
+	if key == "" {
+		return "", quota{}, errors.New("key is empty")
+	}
+
+	q := def
+	if !hasRate {
+		return key, q, nil
+	}
+
+	rate, burst, hasBurst := strings.Cut(limits, ":")
+	var err error
+	if q.rate, err = strconv.ParseFloat(rate, 64); err != nil || q.rate < 0 {
+		return "", quota{}, fmt.Errorf("invalid rate %q", rate)
+	}
+	if !hasBurst {
+		return key, q, nil
+	}
+	if q.burst, err = strconv.Atoi(burst); err != nil || q.burst < 1 {
+		return "", quota{}, fmt.Errorf("invalid burst %q", burst)
+	}
+
+	return key, q, nil
+}
+
+// parseProxy parses an IP or CIDR range.
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Limit rejects requests with an invalid API key, or without one if keys are
+// required, and requests exceeding the quota of their client. The quota is
+// reported in the X-RateLimit-* headers of the response.
+func (l *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	if !l.required && len(l.keys) == 0 && l.anon.rate == 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var client string
+		q := l.anon
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			hash := sha256.Sum256([]byte(key))
+			var ok bool
+			if q, ok = l.keys[hash]; !ok {
+				writeError(w, "invalid API key", http.StatusUnauthorized)
+				return
+			}
+			client = "key:" + hex.EncodeToString(hash[:8])
+		} else if l.required {
+			writeError(w, "API key required", http.StatusUnauthorized)
+			return
+		} else {
+			client = "ip:" + l.clientIP(r)
+		}
+
+		if q.rate == 0 {
+			next(w, r)
+			return
+		}
+
+		remaining, retry, reset := l.take(client, q, time.Now())
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(q.burst))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		if retry > 0 {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(retry)))
+			writeError(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// take removes a token from the bucket of client, returning the tokens left,
+// how long until a token is available if there was none, and how long until
+// the bucket is full again.
+func (l *RateLimiter) take(
+	client string, q quota, now time.Time,
+) (int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{quota: q, tokens: float64(q.burst), last: now}
+		l.buckets[client] = b
+	}
+	b.refill(now)
+
+	var retry time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		retry = secondsDuration((1 - b.tokens) / q.rate)
+	}
+	reset := secondsDuration((float64(q.burst) - b.tokens) / q.rate)
+
+	return int(b.tokens), retry, reset
+}
+
+// sweep removes full buckets, which are the same as new ones. It must be
+// called with l.mu held.
+func (l *RateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.quota.burst) {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientIP returns the IP of the client sending r. Requests from trusted
+// proxies are attributed to the last address in X-Forwarded-For which is not a
+// trusted proxy, as addresses further left may have been sent by the client.
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	ip := addrPort.Addr().Unmap()
+	if !l.trusted(ip) {
+		return ip.String()
+	}
+
+	hops := strings.Split(
+		strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",",
+	)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !l.trusted(ip) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+func (l *RateLimiter) trusted(ip netip.Addr) bool {
+	return slices.ContainsFunc(l.proxies, func(p netip.Prefix) bool {
+		return p.Contains(ip)
+	})
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds rounds d up to whole seconds, as used by Retry-After.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
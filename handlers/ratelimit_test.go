@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"michiru/config"
+)
+
+func newTestLimiter(t *testing.T, cfg config.Config) *RateLimiter {
+	t.Helper()
+	if cfg.RateBurst == 0 {
+		cfg.RateBurst = 1
+	}
+	l, err := NewRateLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewRateLimiter: %v", err)
+	}
+	return l
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	l := newTestLimiter(t, config.Config{})
+	q := quota{rate: 2, burst: 3}
+	start := time.Unix(0, 0)
+
+	steps := []struct {
+		name      string
+		at        time.Duration
+		remaining int
+		retry     time.Duration
+		reset     time.Duration
+	}{
+		{"first request", 0, 2, 0, 500 * time.Millisecond},
+		{"burst", 0, 1, 0, time.Second},
+		{"last token", 0, 0, 0, 1500 * time.Millisecond},
+		{"empty", 0, 0, 500 * time.Millisecond, 1500 * time.Millisecond},
+		{
+			"partly refilled", 250 * time.Millisecond, 0,
+			250 * time.Millisecond, 1250 * time.Millisecond,
+		},
+		{
+			"one token refilled", 500 * time.Millisecond, 0, 0,
+			1500 * time.Millisecond,
+		},
+		{"refilled to burst", time.Hour, 2, 0, 500 * time.Millisecond},
+	}
+	for _, step := range steps {
+		remaining, retry, reset := l.take("client", q, start.Add(step.at))
+		if remaining != step.remaining || retry != step.retry ||
+			reset != step.reset {
+			t.Errorf(
+				"%s: got remaining %d, retry %s, reset %s, want %d, %s, %s",
+				step.name, remaining, retry, reset,
+				step.remaining, step.retry, step.reset,
+			)
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := newTestLimiter(t, config.Config{})
+	q := quota{rate: 1, burst: 2}
+	start := l.lastSweep
+
+	l.take("idle", q, start)
+	l.take("busy", q, start.Add(sweepInterval))
+	l.take("busy", q, start.Add(sweepInterval))
+	l.take("other", q, start.Add(sweepInterval+time.Second))
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("refilled bucket was not removed")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("bucket in use was removed")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	l := newTestLimiter(t, config.Config{
+		TrustedProxies: []string{"10.0.0.0/8", "::1"},
+	})
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{
+			"untrusted proxy is ignored", "203.0.113.5:1234",
+			[]string{"198.51.100.1"}, "203.0.113.5",
+		},
+		{
+			"trusted proxy", "10.0.0.1:1234",
+			[]string{"198.51.100.1"}, "198.51.100.1",
+		},
+		{
+			"trusted proxy without header", "10.0.0.1:1234", nil, "10.0.0.1",
+		},
+		{
+			"spoofed addresses left of the client", "10.0.0.1:1234",
+			[]string{"192.0.2.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1",
+		},
+		{
+			"multiple headers", "10.0.0.1:1234",
+			[]string{"192.0.2.1", "198.51.100.1"}, "198.51.100.1",
+		},
+		{
+			"only trusted proxies", "10.0.0.1:1234",
+			[]string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3",
+		},
+		{
+			"invalid address stops the walk", "10.0.0.1:1234",
+			[]string{"198.51.100.1, unknown, 10.0.0.2"}, "10.0.0.2",
+		},
+		{"ipv6 proxy", "[::1]:1234", []string{"2001:db8::1"}, "2001:db8::1"},
+		{
+			"ipv4-mapped proxy", "[::ffff:10.0.0.1]:1234",
+			[]string{"198.51.100.1"}, "198.51.100.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/search", nil)
+			r.RemoteAddr = tc.remote
+			for _, value := range tc.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := l.clientIP(r); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	def := quota{rate: 1, burst: 10}
+	tests := []struct {
+		entry   string
+		key     string
+		want    quota
+		wantErr bool
+	}{
+		{entry: "abc", key: "abc", want: def},
+		{entry: "abc:5", key: "abc", want: quota{rate: 5, burst: 10}},
+		{entry: "abc:0.5:3", key: "abc", want: quota{rate: 0.5, burst: 3}},
+		{entry: "abc:0", key: "abc", want: quota{rate: 0, burst: 10}},
+		{entry: ":5", wantErr: true},
+		{entry: "abc:fast", wantErr: true},
+		{entry: "abc:-1", wantErr: true},
+		{entry: "abc:1:0", wantErr: true},
+		{entry: "abc:1:many", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.entry, func(t *testing.T) {
+			key, got, err := parseAPIKey(tc.entry, def)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil || key != tc.key || got != tc.want {
+				t.Errorf(
+					"got %q, %+v, %v, want %q, %+v",
+					key, got, err, tc.key, tc.want,
+				)
+			}
+		})
+	}
+}
+
+func TestNewRateLimiterKeysFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	err := os.WriteFile(path, []byte("# comment\n\nfilekey:2:4\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := newTestLimiter(t, config.Config{
+		APIKeys: []string{"envkey"}, APIKeysFile: path,
+	})
+	if len(l.keys) != 2 {
+		t.Errorf("got %d keys, want 2", len(l.keys))
+	}
+
+	_, err = NewRateLimiter(config.Config{RateBurst: 1, APIKeyRequired: true})
+	if err == nil {
+		t.Error("expected an error when keys are required but none are set")
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	l := newTestLimiter(t, config.Config{
+		APIKeys:   []string{"unlimited:0", "limited:1:1"},
+		RateLimit: 1,
+		RateBurst: 2,
+	})
+	handler := l.Limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/search", nil)
+		if key != "" {
+			r.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		status     int
+		limit      string
+		remaining  string
+		retryAfter string
+	}{
+		{"anonymous", "", http.StatusOK, "2", "1", ""},
+		{"anonymous burst", "", http.StatusOK, "2", "0", ""},
+		{"anonymous limited", "", http.StatusTooManyRequests, "2", "0", "1"},
+		{"key quota", "limited", http.StatusOK, "1", "0", ""},
+		{"key limited", "limited", http.StatusTooManyRequests, "1", "0", "1"},
+		{"unlimited key", "unlimited", http.StatusOK, "", "", ""},
+		{"unknown key", "unknown", http.StatusUnauthorized, "", "", ""},
+	}
+	for _, tc := range tests {
+		w := serve(tc.key)
+		h := w.Header()
+		if w.Code != tc.status ||
+			h.Get("X-RateLimit-Limit") != tc.limit ||
+			h.Get("X-RateLimit-Remaining") != tc.remaining ||
+			h.Get("Retry-After") != tc.retryAfter {
+			t.Errorf(
+				"%s: got status %d, limit %q, remaining %q, retry after %q",
+				tc.name, w.Code, h.Get("X-RateLimit-Limit"),
+				h.Get("X-RateLimit-Remaining"), h.Get("Retry-After"),
+			)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"michiru/models"
+)
+
+var (
+	extensionRegexp = regexp.MustCompile(`(?i)\.(mkv|mp4|avi|m4v|webm|ogm|wmv|mov|ts|flv|srt|ass|ssa)$`)
+	bracketRegexp   = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|\{[^}]*\}|【[^】]*】`)
+	// Matches tokens describing the release rather than the anime
+	releaseTokenRegexp = regexp.MustCompile(
+		`(?i)\b(\d{3,4}[pi]|\d{3,4}x\d{3,4}|[xh]\.?26[45]|hevc|avc|xvid|` +
+			`(8|10)-?bits?|aac(2\.0)?|flac|opus|ac3|e-?ac-?3|dts|dual[ -]audio|` +
+			`bd|bdrip|blu-?ray|web(-?dl|-?rip)?|dvd(rip)?|hdtv|remux|uncensored|` +
+			`multi-?subs?|[0-9a-f]{8})\b`,
+	)
+	seasonEpisodeRegexp = regexp.MustCompile(`(?i)\bS(\d{1,2})\s*E(\d{1,4})(v\d)?\b`)
+	dashEpisodeRegexp   = regexp.MustCompile(`\s-\s*(\d{1,4})(v\d)?\b`)
+	episodeRegexp       = regexp.MustCompile(`(?i)\b(?:ep(?:isode)?|e)\.?\s*(\d{1,4})(v\d)?\b`)
+	seasonRegexp        = regexp.MustCompile(
+		`(?i)\bS(\d{1,2})\b|\bseason\s*(\d{1,2})\b|\b(\d{1,2})(?:st|nd|rd|th)\s+season\b`,
+	)
+	whitespaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+// ParseReleaseName extracts the anime title, season and episode from the file
+// name of a typical release, e.g. "[Group] Some Title S2 - 05 (1080p) [ABCD1234].mkv".
+// Release group tags, resolution and codec tokens, CRC hashes and extensions
+// are discarded.
+func ParseReleaseName(filename string) models.ReleaseInfo {
+	var info models.ReleaseInfo
+
+	name := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	name = extensionRegexp.ReplaceAllString(name, "")
+	name = strings.ReplaceAll(name, "_", " ")
+	// Scene releases separate words with dots instead of spaces
+	if !strings.Contains(name, " ") {
+		name = strings.ReplaceAll(name, ".", " ")
+	}
+	name = bracketRegexp.ReplaceAllString(name, " ")
+
+	// The title ends where the episode number begins
+	if m := seasonEpisodeRegexp.FindStringSubmatchIndex(name); m != nil {
+		info.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		info.Episode, _ = strconv.Atoi(name[m[4]:m[5]])
+		name = name[:m[0]]
+	} else if m := dashEpisodeRegexp.FindStringSubmatchIndex(name); m != nil {
+		info.Episode, _ = strconv.Atoi(name[m[2]:m[3]])
+		name = name[:m[0]]
+	} else if m := episodeRegexp.FindStringSubmatchIndex(name); m != nil {
+		info.Episode, _ = strconv.Atoi(name[m[2]:m[3]])
+		name = name[:m[0]]
+	}
+
+	if m := seasonRegexp.FindStringSubmatchIndex(name); m != nil {
+		for i := 2; i < len(m); i += 2 {
+			if m[i] >= 0 {
+				info.Season, _ = strconv.Atoi(name[m[i]:m[i+1]])
+				break
+			}
+		}
+		name = name[:m[0]] + name[m[1]:]
+	}
+
+	name = releaseTokenRegexp.ReplaceAllString(name, " ")
+	name = whitespaceRegexp.ReplaceAllString(name, " ")
+	info.Title = strings.Trim(name, " -.")
+
+	return info
+}
+
+// SearchQuery returns the query used to search for the parsed release.
+// Later seasons are usually separate anime on AniDB, so the season number is
+// included to favour titles containing it.
+func SearchQuery(info models.ReleaseInfo) string {
+	if info.Season > 1 {
+		return info.Title + " " + strconv.Itoa(info.Season)
+	}
+	return info.Title
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"testing"
+
+	"michiru/models"
+)
+
+func TestParseReleaseName(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     models.ReleaseInfo
+	}{
+		{
+			filename: "[Group] Some Title - 05 (1080p) [ABCD1234].mkv",
+			want:     models.ReleaseInfo{Title: "Some Title", Episode: 5},
+		},
+		{
+			filename: "[Group] Some Title S2 - 05v2 [1080p].mkv",
+			want:     models.ReleaseInfo{Title: "Some Title", Season: 2, Episode: 5},
+		},
+		{
+			filename: "Some.Title.S02E13.1080p.WEB-DL.x264.mkv",
+			want:     models.ReleaseInfo{Title: "Some Title", Season: 2, Episode: 13},
+		},
+		{
+			filename: "[Group]_Some_Title_-_12_[720p].mp4",
+			want:     models.ReleaseInfo{Title: "Some Title", Episode: 12},
+		},
+		{
+			filename: "Some Title 2nd Season Episode 3.mkv",
+			want:     models.ReleaseInfo{Title: "Some Title", Season: 2, Episode: 3},
+		},
+		{
+			filename: "Some Title Season 3 - 01 [BD 1080p HEVC 10bit FLAC].mkv",
+			want:     models.ReleaseInfo{Title: "Some Title", Season: 3, Episode: 1},
+		},
+		{
+			filename: `C:\Anime\Some Title\[Group] Some Title - 101 [1080p].mkv`,
+			want:     models.ReleaseInfo{Title: "Some Title", Episode: 101},
+		},
+		{
+			filename: "/anime/Some Title/[Group] Some Title - 07.ass",
+			want:     models.ReleaseInfo{Title: "Some Title", Episode: 7},
+		},
+		{
+			filename: "【Group】 Some Title (2019) - 04 [1080p].mkv",
+			want:     models.ReleaseInfo{Title: "Some Title", Episode: 4},
+		},
+		{
+			filename: "[Group] Some Title - The Movie [BDRip 1080p].mkv",
+			want:     models.ReleaseInfo{Title: "Some Title - The Movie"},
+		},
+		{
+			filename: "[Group] 86 - 02 [1080p].mkv",
+			want:     models.ReleaseInfo{Title: "86", Episode: 2},
+		},
+		{
+			filename: "Some Title Ep.9.avi",
+			want:     models.ReleaseInfo{Title: "Some Title", Episode: 9},
+		},
+		{
+			filename: "",
+			want:     models.ReleaseInfo{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.filename, func(t *testing.T) {
+			if got := ParseReleaseName(tc.filename); got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"michiru/config"
+	"michiru/internal/clients"
+)
+
+// Routes referred to by middleware: the web UI, which also catches every path
+// not matching another route, and the import event stream.
+const (
+	webUIPattern  = "GET /"
+	eventsPattern = "GET /events"
+)
+
+// RegisterRoutes registers the web UI and all API routes on mux, with the
+// public API routes limited by limiter. The admin routes are only registered if
+// cfg.AdminToken is set.
+func RegisterRoutes(
+	mux *http.ServeMux, cfg config.Config, backend clients.SearchBackend,
+	runner *ImportRunner, limiter *RateLimiter,
+) {
+	fs := http.FileServer(http.Dir(cfg.WebUIPath))
+	api := limiter.Limit
+
+	mux.Handle(webUIPattern, fs)
+	mux.HandleFunc("GET /search", api(HandleSearch(backend)))
+	mux.HandleFunc("GET /metadata", api(HandleMetadata(backend)))
+	mux.HandleFunc("GET /metadata/history", api(HandleMetadataHistory(backend)))
+	mux.HandleFunc("GET /anime/{aid}", api(HandleAnime(backend)))
+	mux.HandleFunc("GET /anime/{aid}/history", api(HandleAnimeHistory(backend)))
+	mux.HandleFunc("GET /changes", api(HandleChanges(backend)))
+	mux.HandleFunc("GET /anime", api(HandleAnimeBatch(cfg, backend)))
+	mux.HandleFunc("POST /anime/batch", api(HandleAnimeBatch(cfg, backend)))
+	mux.HandleFunc("GET /resolve", api(HandleResolve(backend)))
+	mux.HandleFunc("GET /suggest", api(HandleSuggest(backend)))
+	mux.HandleFunc(eventsPattern, api(HandleEvents(runner.Events())))
+	mux.HandleFunc("GET /healthz", HandleHealthz())
+	mux.HandleFunc("GET /readyz", HandleReadyz(cfg, backend))
+
+	if cfg.AdminToken == "" {
+		return
+	}
+	mux.HandleFunc(
+		"POST /admin/import", requireAdmin(cfg, HandleAdminImport(runner)),
+	)
+	mux.HandleFunc(
+		"GET /admin/import/{id}",
+		requireAdmin(cfg, HandleAdminImportJob(runner)),
+	)
+	mux.HandleFunc(
+		"GET /admin/imports", requireAdmin(cfg, HandleAdminImports(runner)),
+	)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"michiru/config"
+	"michiru/internal/clients"
+	"michiru/models"
+)
+
+// Scheduler runs imports on a schedule through an ImportRunner.
+type Scheduler struct {
+	cfg     config.Config
+	backend clients.SearchBackend
+	runner  *ImportRunner
+	// next returns the next scheduled import after the given time
+	next func(time.Time) time.Time
+}
+
+// NewScheduler returns a Scheduler for the given schedule, which is either a
+// standard five-field cron expression or an interval such as "24h".
+func NewScheduler(
+	cfg config.Config, backend clients.SearchBackend, runner *ImportRunner,
+	schedule string,
+) (*Scheduler, error) {
+	s := &Scheduler{cfg: cfg, backend: backend, runner: runner}
+
+	if interval, err := time.ParseDuration(schedule); err == nil {
+		if interval <= 0 {
+			return nil, fmt.Errorf("import interval %q must be positive", schedule)
+		}
+		s.next = func(t time.Time) time.Time {
+			return t.Add(interval)
+		}
+		return s, nil
+	}
+
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid import schedule %q: %w", schedule, err)
+	}
+	s.next = sched.Next
+
+	return s, nil
+}
+
+// Start runs scheduled imports until ctx is cancelled. If the previous
+// import missed its schedule, such as while the server was down, an import
+// starts right away.
+func (s *Scheduler) Start(ctx context.Context) {
+	var last time.Time
+	if meta, err := s.backend.GetMetadata(ctx); err != nil {
+		slog.ErrorContext(
+			ctx, "Could not get metadata for import schedule", "error", err,
+		)
+	} else if meta != nil {
+		last = meta.RetrievedAt
+	}
+
+	for {
+		next := s.next(last)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		} else if s.cfg.ImportJitter > 0 {
+			// Avoid every instance fetching the dump at the same moment
+			next = next.Add(rand.N(s.cfg.ImportJitter))
+		}
+		slog.InfoContext(ctx, "Scheduled next import", "at", next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_, err := s.runner.Run(ctx, models.TriggerSchedule, false)
+		if err != nil {
+			slog.ErrorContext(ctx, "Scheduled import failed", "error", err)
+		}
+		last = time.Now()
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"michiru/config"
+	"michiru/internal/metrics"
+	"michiru/internal/tracing"
+)
+
+// NewServer returns a server for the routes registered on mux, with the
+// timeouts and limits of cfg and all middleware applied.
+func NewServer(cfg config.Config, mux *http.ServeMux) *http.Server {
+	handler := CORS(
+		cfg, exceptStreams(
+			mux, LimitConcurrency(mux, cfg.MaxConcurrentRequests),
+		), mux,
+	)
+	handler = AccessLog(metrics.Middleware(handler))
+
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           tracing.Middleware(handler, mux),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog: slog.NewLogLogger(
+			slog.Default().Handler(), slog.LevelWarn,
+		),
+	}
+}
+
+// Serve serves requests with srv until ctx is cancelled, then stops accepting
+// connections and waits up to timeout for in-flight requests to complete.
+func Serve(ctx context.Context, srv *http.Server, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	slog.InfoContext(ctx, "Serving requests", "addr", srv.Addr)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down server", "timeout", timeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+		return fmt.Errorf("error draining connections: %w", err)
+	}
+	return nil
+}
+
+// exceptStreams serves event streams with mux directly and all other requests
+// with limited. Streams stay open for as long as clients are connected, so
+// would otherwise hold their concurrency slots indefinitely; the event broker
+// limits them instead.
+func exceptStreams(mux *http.ServeMux, limited http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == eventsPattern {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
+
+// LimitConcurrency rejects requests with a 503 while limit requests are
+// already being served by next. A limit of 0 or less disables it.
+func LimitConcurrency(next http.Handler, limit int) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+
+	sem := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(
+				w, "too many concurrent requests",
+				http.StatusServiceUnavailable,
+			)
+		}
+	})
+}
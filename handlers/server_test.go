@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitConcurrencyExceptStreams(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	mux.HandleFunc("GET /fast", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc(eventsPattern, func(w http.ResponseWriter, r *http.Request) {})
+	handler := exceptStreams(mux, LimitConcurrency(mux, 1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-entered
+
+	cases := []struct {
+		target string
+		code   int
+	}{
+		{"/fast", http.StatusServiceUnavailable},
+		{"/events", http.StatusOK},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.target, nil))
+		if rec.Code != c.code {
+			t.Errorf("GET %s: got status %d, want %d", c.target, rec.Code, c.code)
+		}
+	}
+
+	close(release)
+	<-done
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d once the slot was released", rec.Code)
+	}
+}
+
+func TestEventBrokerLimit(t *testing.T) {
+	b := NewEventBroker(2)
+
+	_, unsubscribe, ok := b.Subscribe()
+	if !ok {
+		t.Fatal("first subscriber was rejected")
+	}
+	if _, _, ok := b.Subscribe(); !ok {
+		t.Fatal("second subscriber was rejected")
+	}
+	if _, _, ok := b.Subscribe(); ok {
+		t.Error("subscriber over the limit was accepted")
+	}
+
+	unsubscribe()
+	if _, _, ok := b.Subscribe(); !ok {
+		t.Error("subscriber was rejected after another unsubscribed")
+	}
+
+	rec := httptest.NewRecorder()
+	HandleEvents(b)(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for stream over the limit, want 503", rec.Code)
+	}
+}
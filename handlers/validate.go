@@ -1,49 +1,51 @@
-//go:build cgo
-
 package handlers
 
 import (
-	_ "embed"
+	"errors"
 	"fmt"
 	"time"
 
-	xsdvalidate "github.com/terminalstatic/go-xsd-validate"
+	"michiru/config"
 	"michiru/models"
 )
 
-//go:embed schema.xsd
-var schema []byte
-
-func ValidateXml(b []byte) error {
-	err := xsdvalidate.Init()
-	if err != nil {
-		return err
-	}
-	defer xsdvalidate.Cleanup()
+// ErrImportTooSoon is returned by ValidateImportInterval when the previous
+// import is more recent than the import interval.
+var ErrImportTooSoon = errors.New("import interval has not elapsed")
 
-	xsdhandler, err := xsdvalidate.NewXsdHandlerMem(schema, xsdvalidate.ParsErrVerbose)
-	if err != nil {
-		return err
-	}
-	defer xsdhandler.Free()
+// DumpValidator validates the raw XML of single anime elements in the title dump.
+type DumpValidator interface {
+	Validate(anime []byte) error
+	Free()
+}
 
-	err = xsdhandler.ValidateMem(b, xsdvalidate.ValidErrDefault)
-	if err != nil {
-		return err
+// NewDumpValidator returns the validator selected by config.DumpValidator.
+// The "xsd" validator is only available in builds with cgo enabled.
+func NewDumpValidator(cfg config.Config) (DumpValidator, error) {
+	switch cfg.DumpValidator {
+	case "structural":
+		return StructuralValidator{}, nil
+	case "xsd":
+		return newXsdValidator()
+	default:
+		return nil, fmt.Errorf("unknown dump validator %q", cfg.DumpValidator)
 	}
-
-	return nil
 }
 
-func ValidateImportInterval(meta *models.MetadataDocument) error {
+func ValidateImportInterval(
+	meta *models.MetadataDocument, interval time.Duration,
+) error {
 	// We assume no metadata means its the first ever import, so we can skip this check
 	if meta == nil {
 		return nil
 	}
 
-	dayBefore := time.Now().Add(-24 * time.Hour)
-	if meta.RetrievedAt.After(dayBefore) {
-		return fmt.Errorf("last import at %s, less than a day ago", meta.RetrievedAt)
+	earliest := time.Now().Add(-interval)
+	if meta.RetrievedAt.After(earliest) {
+		return fmt.Errorf(
+			"%w: last import at %s, less than %s ago",
+			ErrImportTooSoon, meta.RetrievedAt, interval,
+		)
 	}
 
 	return nil
@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package handlers
+
+import (
+	"errors"
+)
+
+func newXsdValidator() (DumpValidator, error) {
+	return nil, errors.New("xsd validator requires building with cgo enabled")
+}
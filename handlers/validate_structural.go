@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+var (
+	positiveIntegerRegexp = regexp.MustCompile(`^\+?0*[1-9][0-9]*$`)
+	languageRegexp        = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+	titleTypes            = map[string]bool{
+		"main":     true,
+		"official": true,
+		"short":    true,
+		"syn":      true,
+		"kana":     true,
+		"card":     true,
+	}
+)
+
+// StructuralValidator validates anime elements of the title dump against the
+// same rules as schema.xsd in pure Go, so no libxml2 is required.
+type StructuralValidator struct{}
+
+func (v StructuralValidator) Validate(anime []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(anime))
+
+	start, err := nextElement(d)
+	if err != nil {
+		return err
+	}
+	if start.Name.Space != "" || start.Name.Local != "anime" {
+		return fmt.Errorf("unexpected element %s, expected anime", start.Name.Local)
+	}
+	if err = validateAnimeAttrs(start.Attr); err != nil {
+		return err
+	}
+
+	titles := 0
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != "" || t.Name.Local != "title" {
+				return fmt.Errorf(
+					"unexpected element %s in anime, expected title",
+					t.Name.Local,
+				)
+			}
+			if err = validateTitle(d, t); err != nil {
+				return fmt.Errorf("title %d: %w", titles+1, err)
+			}
+			titles++
+		case xml.EndElement:
+			if titles == 0 {
+				return errors.New("anime must have at least one title")
+			}
+			return nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) != 0 {
+				return errors.New("unexpected text in anime")
+			}
+		}
+	}
+}
+
+func (v StructuralValidator) Free() {}
+
+// nextElement skips to the first start element in the decoder.
+func nextElement(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return xml.StartElement{}, errors.New("missing anime element")
+		} else if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		if t, ok := token.(xml.StartElement); ok {
+			return t, nil
+		}
+	}
+}
+
+func validateAnimeAttrs(attrs []xml.Attr) error {
+	hasAid := false
+	for _, attr := range attrs {
+		if attr.Name.Space == "" && attr.Name.Local == "aid" {
+			aid := strings.TrimSpace(attr.Value)
+			if !positiveIntegerRegexp.MatchString(aid) {
+				return fmt.Errorf("aid %q is not a positive integer", attr.Value)
+			}
+			hasAid = true
+		} else if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+			return fmt.Errorf("unexpected anime attribute %s", attr.Name.Local)
+		}
+	}
+
+	if !hasAid {
+		return errors.New("anime is missing required attribute aid")
+	}
+	return nil
+}
+
+// validateTitle validates the attributes and contents of a title element,
+// consuming it from the decoder.
+func validateTitle(d *xml.Decoder, start xml.StartElement) error {
+	hasType, hasLang := false, false
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local == "type":
+			if !titleTypes[attr.Value] {
+				return fmt.Errorf("invalid title type %q", attr.Value)
+			}
+			hasType = true
+		case attr.Name.Space == xmlNamespace && attr.Name.Local == "lang":
+			// xml:lang is either a language tag or empty, as defined by xml.xsd
+			lang := strings.TrimSpace(attr.Value)
+			if lang != "" && !languageRegexp.MatchString(lang) {
+				return fmt.Errorf("invalid title language %q", attr.Value)
+			}
+			hasLang = true
+		case attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns":
+		default:
+			return fmt.Errorf("unexpected title attribute %s", attr.Name.Local)
+		}
+	}
+
+	if !hasType {
+		return errors.New("title is missing required attribute type")
+	}
+	if !hasLang {
+		return errors.New("title is missing required attribute xml:lang")
+	}
+
+	// Titles may only contain text
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			return errors.New("unexpected element in title")
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// validatorCases are anime elements which are valid or not according to
+// schema.xsd. They are also checked against the schema itself in cgo builds.
+var validatorCases = []struct {
+	name  string
+	anime string
+	valid bool
+}{
+	{
+		name:  "single title",
+		anime: `<anime aid="1"><title type="main" xml:lang="x-jat">Seikai no Monshou</title></anime>`,
+		valid: true,
+	},
+	{
+		name: "all title types",
+		anime: `<anime aid="1">
+			<title type="main" xml:lang="x-jat">A</title>
+			<title type="official" xml:lang="en">B</title>
+			<title type="short" xml:lang="en">C</title>
+			<title type="syn" xml:lang="zh-Hans">D</title>
+			<title type="kana" xml:lang="ja">E</title>
+			<title type="card" xml:lang="en">F</title>
+		</anime>`,
+		valid: true,
+	},
+	{
+		name:  "signed aid with leading zeros",
+		anime: `<anime aid="+007"><title type="main" xml:lang="x-jat">A</title></anime>`,
+		valid: true,
+	},
+	{
+		name:  "aid surrounded by whitespace",
+		anime: `<anime aid=" 1 "><title type="main" xml:lang="x-jat">A</title></anime>`,
+		valid: true,
+	},
+	{
+		name:  "empty language",
+		anime: `<anime aid="1"><title type="main" xml:lang="">A</title></anime>`,
+		valid: true,
+	},
+	{
+		name:  "empty title",
+		anime: `<anime aid="1"><title type="main" xml:lang="x-jat"></title></anime>`,
+		valid: true,
+	},
+	{
+		name:  "zero aid",
+		anime: `<anime aid="0"><title type="main" xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "negative aid",
+		anime: `<anime aid="-1"><title type="main" xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "non-numeric aid",
+		anime: `<anime aid="abc"><title type="main" xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "missing aid",
+		anime: `<anime><title type="main" xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "unexpected anime attribute",
+		anime: `<anime aid="1" type="tv"><title type="main" xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "no titles",
+		anime: `<anime aid="1"></anime>`,
+	},
+	{
+		name:  "unknown title type",
+		anime: `<anime aid="1"><title type="alt" xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "missing title type",
+		anime: `<anime aid="1"><title xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "missing title language",
+		anime: `<anime aid="1"><title type="main">A</title></anime>`,
+	},
+	{
+		name:  "lang without xml namespace",
+		anime: `<anime aid="1"><title type="main" lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "invalid language",
+		anime: `<anime aid="1"><title type="main" xml:lang="en_US">A</title></anime>`,
+	},
+	{
+		name:  "element in title",
+		anime: `<anime aid="1"><title type="main" xml:lang="x-jat">A<b>B</b></title></anime>`,
+	},
+	{
+		name:  "unexpected element in anime",
+		anime: `<anime aid="1"><name>A</name></anime>`,
+	},
+	{
+		name:  "text in anime",
+		anime: `<anime aid="1">A<title type="main" xml:lang="x-jat">A</title></anime>`,
+	},
+	{
+		name:  "unexpected root element",
+		anime: `<manga aid="1"><title type="main" xml:lang="x-jat">A</title></manga>`,
+	},
+}
+
+func TestStructuralValidator(t *testing.T) {
+	v := StructuralValidator{}
+	for _, tc := range validatorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Validate([]byte(tc.anime))
+			if tc.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			} else if !tc.valid && err == nil {
+				t.Error("expected an error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+//go:build cgo
+
+package handlers
+
+import (
+	"bytes"
+	_ "embed"
+
+	xsdvalidate "github.com/terminalstatic/go-xsd-validate"
+)
+
+//go:embed schema.xsd
+var schema []byte
+
+// XmlValidator validates anime elements of the title dump against schema.xsd.
+type XmlValidator struct {
+	handler *xsdvalidate.XsdHandler
+}
+
+// NewXmlValidator initialises libxml2 and parses the embedded schema.
+// Free must be called once the validator is no longer needed.
+func NewXmlValidator() (*XmlValidator, error) {
+	err := xsdvalidate.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	xsdhandler, err := xsdvalidate.NewXsdHandlerMem(schema, xsdvalidate.ParsErrVerbose)
+	if err != nil {
+		xsdvalidate.Cleanup()
+		return nil, err
+	}
+
+	return &XmlValidator{handler: xsdhandler}, nil
+}
+
+func newXsdValidator() (DumpValidator, error) {
+	v, err := NewXmlValidator()
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Validate validates the raw XML of a single anime element, by wrapping it in
+// the root element of the title dump.
+func (v *XmlValidator) Validate(anime []byte) error {
+	var b bytes.Buffer
+	b.Grow(len(anime) + 27)
+	b.WriteString("<animetitles>")
+	b.Write(anime)
+	b.WriteString("</animetitles>")
+
+	return v.handler.ValidateMem(b.Bytes(), xsdvalidate.ValidErrDefault)
+}
+
+func (v *XmlValidator) Free() {
+	v.handler.Free()
+	xsdvalidate.Cleanup()
+}
@@ -0,0 +1,28 @@
+//go:build cgo
+
+package handlers
+
+import (
+	"testing"
+)
+
+// TestXmlValidator checks the validator cases against schema.xsd itself, so
+// that the structural validator is known to follow the schema.
+func TestXmlValidator(t *testing.T) {
+	v, err := NewXmlValidator()
+	if err != nil {
+		t.Skipf("could not load schema: %v", err)
+	}
+	defer v.Free()
+
+	for _, tc := range validatorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Validate([]byte(tc.anime))
+			if tc.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			} else if !tc.valid && err == nil {
+				t.Error("expected an error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"michiru/config"
+	"michiru/internal/tracing"
+	"michiru/models"
+)
+
+// SignatureHeader holds the hex-encoded HMAC-SHA256 of a webhook body, keyed
+// with config.WebhookSecret and prefixed with "sha256=".
+const SignatureHeader = "X-Michiru-Signature"
+
+// webhookBackoff is the delay before the first retry of a failed delivery.
+// It is shortened by tests.
+var webhookBackoff = time.Second
+
+// ValidateWebhookConfig returns an error if webhooks are enabled without a
+// secret to sign them with, as receivers could not tell them from forgeries.
+func ValidateWebhookConfig(cfg config.Config) error {
+	if len(cfg.WebhookURLs) > 0 && cfg.WebhookSecret == "" {
+		return errors.New("webhook URLs are set without a webhook secret")
+	}
+	return nil
+}
+
+// SendWebhooks posts payload to every URL in cfg.WebhookURLs concurrently,
+// retrying failed deliveries, and returns a delivery log with an entry per URL.
+// The payload is stamped with the time it is first sent, which is signed along
+// with it so that receivers can reject replayed deliveries.
+//
+// Deliveries still failing after cfg.WebhookDeadline are abandoned, so that
+// unreachable receivers cannot hold up the import sending them for long.
+func SendWebhooks(
+	ctx context.Context, cfg config.Config, payload models.WebhookPayload,
+) []models.WebhookDelivery {
+	if len(cfg.WebhookURLs) == 0 {
+		return nil
+	}
+
+	if cfg.WebhookDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.WebhookDeadline)
+		defer cancel()
+	}
+
+	payload.SentAt = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not encode webhook payload", "error", err)
+		return nil
+	}
+
+	mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	deliveries := make([]models.WebhookDelivery, len(cfg.WebhookURLs))
+	var wg sync.WaitGroup
+	for i, url := range cfg.WebhookURLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliveries[i] = deliverWebhook(
+				ctx, cfg, url, payload.Event, body, signature,
+			)
+		}()
+	}
+	wg.Wait()
+
+	return deliveries
+}
+
+// deliverWebhook posts body to url until it is accepted, a non-retryable
+// response is received, or cfg.WebhookRetries retries have failed.
+func deliverWebhook(
+	ctx context.Context, cfg config.Config, url string, event string,
+	body []byte, signature string,
+) models.WebhookDelivery {
+	delivery := models.WebhookDelivery{URL: url, SentAt: time.Now().UTC()}
+	client := &http.Client{
+		Timeout:   cfg.WebhookTimeout,
+		Transport: tracing.Transport(http.DefaultTransport),
+	}
+
+	backoff := webhookBackoff
+	for {
+		delivery.Attempts++
+
+		status, err := postWebhook(ctx, client, url, event, body, signature)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			slog.InfoContext(
+				ctx, "Delivered webhook", "event", event, "url", url,
+				"attempts", delivery.Attempts,
+			)
+			return delivery
+		}
+		delivery.Error = err.Error()
+
+		// Other client errors will not succeed by sending the same request
+		retryable := status == 0 || status == http.StatusTooManyRequests ||
+			status >= 500
+		if !retryable || delivery.Attempts > cfg.WebhookRetries {
+			slog.ErrorContext(
+				ctx, "Could not deliver webhook", "event", event, "url", url,
+				"attempts", delivery.Attempts, "error", err,
+			)
+			return delivery
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			delivery.Error = ctx.Err().Error()
+			return delivery
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// postWebhook makes a single delivery attempt, returning the response status
+// if a response was received.
+func postWebhook(
+	ctx context.Context, client *http.Client, url string, event string,
+	body []byte, signature string,
+) (int, error) {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, url, bytes.NewReader(body),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "michiru-webhook")
+	req.Header.Set("X-Michiru-Event", event)
+	req.Header.Set(SignatureHeader, signature)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"michiru/config"
+	"michiru/models"
+)
+
+// webhookReceiver records the webhook requests it receives, responding with
+// the given statuses in turn and then with 204.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	status := http.StatusNoContent
+	if n := len(wr.bodies); n < len(wr.statuses) {
+		status = wr.statuses[n]
+	}
+	wr.bodies = append(wr.bodies, body)
+	wr.headers = append(wr.headers, r.Header.Clone())
+	w.WriteHeader(status)
+}
+
+func shortenWebhookBackoff(t *testing.T) {
+	t.Helper()
+	prev := webhookBackoff
+	webhookBackoff = time.Millisecond
+	t.Cleanup(func() { webhookBackoff = prev })
+}
+
+func TestSendWebhooksSignature(t *testing.T) {
+	receiver := &webhookReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	cfg := config.Config{
+		WebhookURLs:    []string{srv.URL},
+		WebhookSecret:  "secret",
+		WebhookTimeout: time.Second,
+	}
+	payload := models.WebhookPayload{
+		Event:    models.EventImport,
+		ReportId: "report",
+		Outcome:  models.OutcomeSucceeded,
+	}
+	deliveries := SendWebhooks(t.Context(), cfg, payload)
+
+	if len(deliveries) != 1 || !deliveries[0].Delivered {
+		t.Fatalf("got deliveries %+v", deliveries)
+	}
+	if len(receiver.bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(receiver.bodies))
+	}
+	body := receiver.bodies[0]
+
+	mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := receiver.headers[0].Get(SignatureHeader); got != want {
+		t.Errorf("got signature %s, want %s of the body", got, want)
+	}
+
+	var got models.WebhookPayload
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("invalid body %q: %v", body, err)
+	}
+	if got.ReportId != payload.ReportId || got.SentAt.IsZero() ||
+		time.Since(got.SentAt) > time.Minute {
+		t.Errorf("got payload %+v", got)
+	}
+}
+
+func TestSendWebhooksRetries(t *testing.T) {
+	shortenWebhookBackoff(t)
+
+	cases := []struct {
+		name      string
+		statuses  []int
+		attempts  int
+		delivered bool
+		status    int
+	}{
+		{"accepted", nil, 1, true, http.StatusNoContent},
+		{
+			"server error retried",
+			[]int{http.StatusInternalServerError, http.StatusBadGateway},
+			3, true, http.StatusNoContent,
+		},
+		{
+			"rate limited retried", []int{http.StatusTooManyRequests}, 2,
+			true, http.StatusNoContent,
+		},
+		{
+			"client error not retried", []int{http.StatusBadRequest}, 1,
+			false, http.StatusBadRequest,
+		},
+		{
+			"gone not retried", []int{http.StatusGone}, 1, false,
+			http.StatusGone,
+		},
+		{
+			"retries exhausted",
+			[]int{500, 500, 500, 500, 500}, 3, false,
+			http.StatusInternalServerError,
+		},
+	}
+	for _, c := range cases {
+		receiver := &webhookReceiver{statuses: c.statuses}
+		srv := httptest.NewServer(receiver)
+
+		cfg := config.Config{
+			WebhookURLs:    []string{srv.URL},
+			WebhookSecret:  "secret",
+			WebhookRetries: 2,
+			WebhookTimeout: time.Second,
+		}
+		deliveries := SendWebhooks(
+			t.Context(), cfg, models.WebhookPayload{Event: models.EventImport},
+		)
+		srv.Close()
+
+		d := deliveries[0]
+		if d.Attempts != c.attempts || d.Delivered != c.delivered ||
+			d.StatusCode != c.status || len(receiver.bodies) != c.attempts {
+			t.Errorf(
+				"%s: got %d attempts, %d requests, delivered %t, status %d, "+
+					"want %d, %d, %t, %d",
+				c.name, d.Attempts, len(receiver.bodies), d.Delivered,
+				d.StatusCode, c.attempts, c.attempts, c.delivered, c.status,
+			)
+		}
+
+		// Retries resend the exact body, so its signature stays valid
+		for _, body := range receiver.bodies[1:] {
+			if string(body) != string(receiver.bodies[0]) {
+				t.Errorf("%s: retry sent a different body", c.name)
+			}
+		}
+	}
+}
+
+func TestSendWebhooksDeadline(t *testing.T) {
+	receiver := &webhookReceiver{
+		statuses: []int{http.StatusServiceUnavailable},
+	}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	// The first retry is only due after the deadline
+	cfg := config.Config{
+		WebhookURLs:     []string{srv.URL},
+		WebhookSecret:   "secret",
+		WebhookRetries:  3,
+		WebhookTimeout:  time.Second,
+		WebhookDeadline: 50 * time.Millisecond,
+	}
+	start := time.Now()
+	deliveries := SendWebhooks(
+		t.Context(), cfg, models.WebhookPayload{Event: models.EventImport},
+	)
+
+	if elapsed := time.Since(start); elapsed > webhookBackoff/2 {
+		t.Errorf("deliveries took %s, beyond the deadline", elapsed)
+	}
+	if d := deliveries[0]; d.Delivered || d.Attempts != 1 || d.Error == "" {
+		t.Errorf("got delivery %+v, want one failed attempt", d)
+	}
+}
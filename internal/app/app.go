@@ -0,0 +1,109 @@
+// Package app runs the michiru API server, shared by the server and
+// standalone binaries.
+package app
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os/signal"
+	"syscall"
+
+	"michiru/config"
+	"michiru/handlers"
+	"michiru/internal/clients"
+	"michiru/internal/logging"
+	"michiru/internal/metrics"
+	"michiru/internal/tracing"
+)
+
+// Run serves the API until SIGINT or SIGTERM is received, exiting on any
+// error. The configuration is loaded from the environment and then passed to
+// override, if not nil, so that binaries can fix some of it. Spans are
+// exported as service.
+func Run(service string, override func(*config.Config)) {
+	ctx, stop := signal.NotifyContext(
+		context.Background(), syscall.SIGINT, syscall.SIGTERM,
+	)
+	defer stop()
+
+	healthcheck := flag.Bool(
+		"healthcheck", false,
+		"check the readiness of the server running on PORT and exit",
+	)
+	flag.Parse()
+
+	var cfg config.Config
+	if err := config.Load(&cfg); err != nil {
+		logging.Fatal("Could not load configuration", err)
+	}
+	if override != nil {
+		override(&cfg)
+	}
+	if err := logging.Setup(cfg); err != nil {
+		logging.Fatal("Could not set up logging", err)
+	}
+	if err := handlers.ValidateWebhookConfig(cfg); err != nil {
+		logging.Fatal("Invalid webhook configuration", err)
+	}
+
+	if *healthcheck {
+		err := handlers.Probe(ctx, "http://localhost:"+cfg.Port+"/readyz")
+		if err != nil {
+			logging.Fatal("Server is not ready", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg, service)
+	if err != nil {
+		logging.Fatal("Could not set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	backend, err := clients.NewBackend(cfg)
+	if err != nil {
+		logging.Fatal("Could not create search backend", err)
+	}
+
+	// In-process backends cannot be filled by the importer, so the server
+	// must import the title dump itself
+	if cfg.SearchBackend == "memory" || cfg.SearchBackend == "disk" {
+		if err = backend.Init(ctx); err != nil {
+			logging.Fatal("Could not initialise search backend", err)
+		}
+		if cfg.ImportSchedule == "" {
+			cfg.ImportSchedule = cfg.ImportInterval.String()
+		}
+	}
+
+	events := handlers.NewEventBroker(cfg.MaxEventStreams)
+	runner := handlers.NewImportRunner(ctx, cfg, backend, events)
+	if cfg.ImportSchedule != "" {
+		scheduler, err := handlers.NewScheduler(
+			cfg, backend, runner, cfg.ImportSchedule,
+		)
+		if err != nil {
+			logging.Fatal("Could not create import scheduler", err)
+		}
+		go scheduler.Start(ctx)
+	}
+
+	// Dependencies register debug handlers on http.DefaultServeMux, which
+	// must not be exposed
+	mux := http.NewServeMux()
+	metrics.Registry.MustRegister(metrics.NewIndexCollector(backend))
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	limiter, err := handlers.NewRateLimiter(cfg)
+	if err != nil {
+		logging.Fatal("Could not configure API keys and rate limits", err)
+	}
+	handlers.RegisterRoutes(mux, cfg, backend, runner, limiter)
+	srv := handlers.NewServer(cfg, mux)
+	// Event streams never go idle, so they must end for shutdown to complete
+	srv.RegisterOnShutdown(events.Close)
+	if err := handlers.Serve(ctx, srv, cfg.ShutdownTimeout); err != nil {
+		logging.Fatal("Could not serve requests", err)
+	}
+}
@@ -0,0 +1,111 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"michiru/config"
+	"michiru/models"
+)
+
+// SearchBackend stores imported anime and serves title searches over them.
+type SearchBackend interface {
+	// Init sets up any storage required by the backend. If it already
+	// exists, it is left untouched.
+	Init(ctx context.Context) error
+	// Reset deletes ALL data stored by the backend.
+	Reset(ctx context.Context) error
+	// Ping checks that the backend is reachable and able to serve requests.
+	Ping(ctx context.Context) error
+
+	// GetAnimeHashes returns the content hashes of all anime stored by the
+	// previous import, keyed by aid.
+	GetAnimeHashes(ctx context.Context) (map[string]string, error)
+	// NewStagingIndex starts a full rebuild of the stored anime, which only
+	// replaces the served anime once committed.
+	NewStagingIndex(ctx context.Context) (StagingIndex, error)
+	// UpdateAnime upserts the supplied anime and deletes the removed aids.
+	UpdateAnime(
+		ctx context.Context, upserts []models.AnimeDocument, removed []string,
+		meta *models.MetadataDocument,
+	) error
+
+	SearchAnime(
+		ctx context.Context, params *models.QueryParams,
+	) ([]models.AnimeSearchDocument, int, error)
+	// SuggestTitles returns the best matching title of each of the top anime
+	// for a prefix query.
+	SuggestTitles(
+		ctx context.Context, query string, limit int,
+	) ([]models.Suggestion, error)
+	// GetAnime returns the anime with the given aid, or nil if it does not exist.
+	GetAnime(ctx context.Context, aid string) (*models.AnimeDocument, error)
+	// GetAnimeBatch returns the anime with the given aids keyed by aid.
+	// Unknown aids are absent from the result.
+	GetAnimeBatch(
+		ctx context.Context, aids []string,
+	) (map[string]models.AnimeDocument, error)
+	// CountAnime returns the number of anime in the search index.
+	CountAnime(ctx context.Context) (int64, error)
+
+	// GetMetadata returns the metadata of the last import, or nil if there
+	// has been no import yet.
+	GetMetadata(ctx context.Context) (*models.MetadataDocument, error)
+	UpdateMetadata(ctx context.Context, meta *models.MetadataDocument) error
+
+	// AddTitleChanges records title changes in the change log.
+	AddTitleChanges(ctx context.Context, changes []models.TitleChange) error
+	// GetAnimeTitleChanges returns all recorded title changes of an anime,
+	// oldest first.
+	GetAnimeTitleChanges(
+		ctx context.Context, aid string,
+	) ([]models.TitleChange, error)
+	// GetTitleChanges returns the title changes made after since, oldest
+	// first, along with the total number of such changes.
+	GetTitleChanges(
+		ctx context.Context, since time.Time, offset int, limit int,
+	) ([]models.TitleChange, int, error)
+
+	// AddImportReport records the report of an import run in the import history.
+	AddImportReport(ctx context.Context, report models.ImportReport) error
+	// GetImportReports returns import reports, most recent first, along with
+	// the total number of reports.
+	GetImportReports(
+		ctx context.Context, offset int, limit int,
+	) ([]models.ImportReport, int, error)
+}
+
+// StagingIndex is populated with every anime during a full rebuild, and
+// replaces the served anime once committed.
+type StagingIndex interface {
+	Add(doc models.AnimeDocument) error
+	// Commit verifies the staged anime against meta.DumpEntries and replaces
+	// the served anime with them.
+	Commit(meta *models.MetadataDocument) error
+	// Discard releases the resources of the staging index. It must always be
+	// called, including after a successful Commit.
+	Discard()
+}
+
+// NewBackend returns the search backend selected by config.SearchBackend,
+// with its calls traced.
+func NewBackend(cfg config.Config) (SearchBackend, error) {
+	var backend SearchBackend
+	switch cfg.SearchBackend {
+	case "meilisearch":
+		m, err := NewMeilisearch(cfg)
+		if err != nil {
+			return nil, err
+		}
+		backend = m
+	case "memory":
+		backend = NewMemory(cfg)
+	case "disk":
+		backend = NewDisk(cfg)
+	default:
+		return nil, fmt.Errorf("unknown search backend %q", cfg.SearchBackend)
+	}
+
+	return Traced(backend), nil
+}
@@ -0,0 +1,159 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+	"michiru/models"
+)
+
+// maxAnimeTitleChanges is the maximum number of changes returned for a
+// single anime.
+const maxAnimeTitleChanges = 1000
+
+// changeDocument is a title change as stored in Meilisearch, with a numeric
+// timestamp to filter and sort changes by.
+type changeDocument struct {
+	models.TitleChange
+	Timestamp int64 `json:"timestamp"`
+}
+
+// maxLogHits is the number of documents of the change and history logs which
+// can be paged through, raised from the Meilisearch default of 1000 so that
+// consumers can read the whole log.
+const maxLogHits = 1_000_000_000
+
+// createChangesIndex creates a title change index with the given uid,
+// filterable by aid and time.
+func (m *Meilisearch) createChangesIndex(ctx context.Context, uid string) error {
+	if err := m.createIndex(ctx, uid, "id"); err != nil {
+		return err
+	}
+
+	return m.updateChangesIndexSettings(ctx, uid)
+}
+
+// updateChangesIndexSettings applies the settings used for all title change
+// indexes to the index with the given uid.
+func (m *Meilisearch) updateChangesIndexSettings(
+	ctx context.Context, uid string,
+) error {
+	c := m.client
+
+	task, err := c.Index(uid).UpdateSettingsWithContext(
+		ctx, &meilisearch.Settings{
+			FilterableAttributes: []string{"aid", "timestamp"},
+			SortableAttributes:   []string{"timestamp", "id"},
+			Pagination:           &meilisearch.Pagination{MaxTotalHits: maxLogHits},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error updating index settings: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, task.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("error waiting for settings update: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Meilisearch) AddTitleChanges(
+	ctx context.Context, changes []models.TitleChange,
+) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	c := m.client
+	idx := c.Index(changesIndexName(m.cfg.IndexName))
+
+	docs := make([]changeDocument, 0, len(changes))
+	for _, change := range changes {
+		docs = append(
+			docs, changeDocument{
+				TitleChange: change,
+				Timestamp:   change.ChangedAt.UnixMilli(),
+			},
+		)
+	}
+
+	tasks, err := idx.AddDocumentsInBatchesWithContext(
+		ctx, docs, m.cfg.ImportBatchSize,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating change insertion tasks: %w", err)
+	}
+
+	for _, task := range tasks {
+		res, err := m.waitForTask(ctx, task.TaskUID)
+		if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+			return fmt.Errorf(
+				"error waiting for change insertion task completion: %w", err,
+			)
+		}
+	}
+
+	return nil
+}
+
+func (m *Meilisearch) GetAnimeTitleChanges(
+	ctx context.Context, aid string,
+) ([]models.TitleChange, error) {
+	changes, _, err := m.searchTitleChanges(
+		ctx, fmt.Sprintf("aid = %s", aid), 0, maxAnimeTitleChanges,
+	)
+	return changes, err
+}
+
+func (m *Meilisearch) GetTitleChanges(
+	ctx context.Context, since time.Time, offset int, limit int,
+) ([]models.TitleChange, int, error) {
+	return m.searchTitleChanges(
+		ctx, fmt.Sprintf("timestamp > %d", since.UnixMilli()), offset, limit,
+	)
+}
+
+// searchTitleChanges returns the title changes matching filter, oldest first.
+func (m *Meilisearch) searchTitleChanges(
+	ctx context.Context, filter string, offset int, limit int,
+) ([]models.TitleChange, int, error) {
+	c := m.client
+	idx := c.Index(changesIndexName(m.cfg.IndexName))
+
+	res, err := idx.SearchWithContext(
+		ctx, "", &meilisearch.SearchRequest{
+			Offset: int64(offset),
+			Limit:  int64(limit),
+			Filter: filter,
+			Sort:   []string{"timestamp:asc", "id:asc"},
+		},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return make([]models.TitleChange, 0), 0, nil
+		}
+		return nil, 0, fmt.Errorf("error getting title changes: %w", err)
+	}
+
+	var docs []changeDocument
+	if err = decodeHits(ctx, res.Hits, &docs); err != nil {
+		return nil, 0, err
+	}
+
+	changes := make([]models.TitleChange, 0, len(docs))
+	for _, doc := range docs {
+		changes = append(changes, doc.TitleChange)
+	}
+
+	return changes, int(res.EstimatedTotalHits), nil
+}
+
+// changesIndexName returns the uid of the title change index belonging to the
+// title index with the given uid.
+func changesIndexName(uid string) string {
+	return uid + "_changes"
+}
@@ -1,8 +0,0 @@
-package clients
-
-import (
-	"log"
-	"os"
-)
-
-var logger = log.New(os.Stdout, "", log.LstdFlags)
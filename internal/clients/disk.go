@@ -0,0 +1,177 @@
+package clients
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"michiru/config"
+	"michiru/models"
+)
+
+// diskFormatVersion is bumped whenever the snapshot format changes, so that
+// stale snapshots are rebuilt instead of misread.
+const diskFormatVersion = 1
+
+// Disk is a Memory backend which persists its index to a file in
+// config.DataDir, so that it survives restarts without an external service.
+//
+// The index is saved when metadata is updated, which is the final step of an
+// import, so a snapshot always holds a complete import. It is also saved when
+// an import report is added, so that the history of failed imports is kept.
+type Disk struct {
+	*Memory
+	path string
+}
+
+// diskSnapshot is the on-disk representation of the index of a Memory backend.
+type diskSnapshot struct {
+	Version int
+	Meta    *models.MetadataDocument
+	Anime   map[string]models.AnimeDocument
+	Titles  []models.TitleDocument
+	Words   [][]string
+	Grams   map[string][]int32
+	Changes []models.TitleChange
+	History []models.ImportReport
+}
+
+func NewDisk(cfg config.Config) *Disk {
+	return &Disk{
+		Memory: NewMemory(cfg),
+		path:   filepath.Join(cfg.DataDir, cfg.IndexName+".idx"),
+	}
+}
+
+// Init loads the index saved by a previous run, if any.
+func (d *Disk) Init(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Dir(d.path), 0o755); err != nil {
+		return fmt.Errorf("error creating data directory: %w", err)
+	}
+
+	f, err := os.Open(d.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening index: %w", err)
+	}
+	defer f.Close()
+
+	var snapshot diskSnapshot
+	if err = gob.NewDecoder(bufio.NewReader(f)).Decode(&snapshot); err != nil {
+		return fmt.Errorf("error reading index: %w", err)
+	}
+	if snapshot.Version != diskFormatVersion {
+		slog.InfoContext(
+			ctx, "Index format is outdated, it will be rebuilt",
+			"version", snapshot.Version,
+		)
+		return nil
+	}
+
+	titles := make([]memoryTitle, len(snapshot.Titles))
+	for i, title := range snapshot.Titles {
+		titles[i] = memoryTitle{TitleDocument: title, words: snapshot.Words[i]}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.meta = snapshot.Meta
+	d.anime = snapshot.Anime
+	d.titles = titles
+	d.grams = snapshot.Grams
+	d.changes = snapshot.Changes
+	d.history = snapshot.History
+
+	slog.InfoContext(
+		ctx, "Loaded index", "anime", len(d.anime), "path", d.path,
+	)
+	return nil
+}
+
+func (d *Disk) Reset(ctx context.Context) error {
+	if err := d.Memory.Reset(ctx); err != nil {
+		return err
+	}
+
+	err := os.Remove(d.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error deleting index: %w", err)
+	}
+	return nil
+}
+
+func (d *Disk) UpdateMetadata(
+	ctx context.Context, meta *models.MetadataDocument,
+) error {
+	if err := d.Memory.UpdateMetadata(ctx, meta); err != nil {
+		return err
+	}
+	return d.save()
+}
+
+func (d *Disk) AddImportReport(
+	ctx context.Context, report models.ImportReport,
+) error {
+	if err := d.Memory.AddImportReport(ctx, report); err != nil {
+		return err
+	}
+	return d.save()
+}
+
+// save atomically replaces the index file with the current index.
+func (d *Disk) save() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	snapshot := diskSnapshot{
+		Version: diskFormatVersion,
+		Meta:    d.meta,
+		Anime:   d.anime,
+		Titles:  make([]models.TitleDocument, len(d.titles)),
+		Words:   make([][]string, len(d.titles)),
+		Grams:   d.grams,
+		Changes: d.changes,
+		History: d.history,
+	}
+	for i, title := range d.titles {
+		snapshot.Titles[i] = title.TitleDocument
+		snapshot.Words[i] = title.words
+	}
+
+	// Write to a temporary file first, so a crash never leaves a partial index
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating index file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err = gob.NewEncoder(w).Encode(snapshot); err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing index: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), d.path); err != nil {
+		return fmt.Errorf("error replacing index: %w", err)
+	}
+
+	slog.Info("Saved index", "anime", len(snapshot.Anime), "path", d.path)
+	return nil
+}
@@ -0,0 +1,125 @@
+package clients
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"michiru/config"
+	"michiru/models"
+)
+
+func newTestDisk(t *testing.T, dir string) *Disk {
+	t.Helper()
+	d := NewDisk(config.Config{DataDir: dir, IndexName: "anime"})
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return d
+}
+
+func TestDiskSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d := newTestDisk(t, dir)
+	meta := &models.MetadataDocument{
+		RetrievedAt: start, DumpEntries: int64(len(testAnime)),
+	}
+	if err := d.UpdateAnime(ctx, testAnime, nil, meta); err != nil {
+		t.Fatalf("UpdateAnime: %v", err)
+	}
+	if err := d.AddTitleChanges(ctx, testChanges(start)); err != nil {
+		t.Fatalf("AddTitleChanges: %v", err)
+	}
+	if err := d.UpdateMetadata(ctx, meta); err != nil {
+		t.Fatalf("UpdateMetadata: %v", err)
+	}
+	report := models.ImportReport{Id: "report", StartedAt: start}
+	if err := d.AddImportReport(ctx, report); err != nil {
+		t.Fatalf("AddImportReport: %v", err)
+	}
+
+	loaded := newTestDisk(t, dir)
+
+	if n, _ := loaded.CountAnime(ctx); n != int64(len(testAnime)) {
+		t.Errorf("loaded %d anime, want %d", n, len(testAnime))
+	}
+	gotMeta, _ := loaded.GetMetadata(ctx)
+	if gotMeta == nil || !gotMeta.RetrievedAt.Equal(start) ||
+		gotMeta.Id != "anime" {
+		t.Errorf("loaded metadata %+v", gotMeta)
+	}
+
+	// Searching relies on the restored titles and trigram index
+	params := models.QueryParams{Query: "atack titan", Limit: 10}
+	docs, _, err := loaded.SearchAnime(ctx, &params)
+	if err != nil || len(docs) != 1 || docs[0].Aid != "3" {
+		t.Errorf("got search results %v, %v after loading", docs, err)
+	}
+	want, _, _ := d.SearchAnime(ctx, &params)
+	if !slices.EqualFunc(docs, want, func(a, b models.AnimeSearchDocument) bool {
+		return a.Hash() == b.Hash() && a.RankingScore == b.RankingScore
+	}) {
+		t.Errorf("got search results %v, want %v as before saving", docs, want)
+	}
+
+	changes, count, _ := loaded.GetTitleChanges(ctx, time.Time{}, 0, 10)
+	if count != 4 || len(changes) != 4 || changes[3].Id != "d" {
+		t.Errorf("loaded title changes %v", changes)
+	}
+	reports, count, _ := loaded.GetImportReports(ctx, 0, 10)
+	if count != 1 || reports[0].Id != "report" {
+		t.Errorf("loaded import reports %v", reports)
+	}
+}
+
+func TestDiskOutdatedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	d := newTestDisk(t, dir)
+	f, err := os.Create(d.path)
+	if err != nil {
+		t.Fatalf("creating snapshot: %v", err)
+	}
+	err = gob.NewEncoder(f).Encode(
+		diskSnapshot{
+			Version: diskFormatVersion - 1,
+			Meta:    &models.MetadataDocument{Id: "anime"},
+			Anime:   map[string]models.AnimeDocument{"1": testAnime[0]},
+		},
+	)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("writing snapshot: %v", err)
+	}
+
+	// The snapshot is ignored, so the next import rebuilds the index
+	loaded := newTestDisk(t, dir)
+	if n, _ := loaded.CountAnime(ctx); n != 0 {
+		t.Errorf("loaded %d anime from an outdated snapshot", n)
+	}
+	if meta, _ := loaded.GetMetadata(ctx); meta != nil {
+		t.Errorf("loaded metadata %+v from an outdated snapshot", meta)
+	}
+}
+
+func TestDiskCorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	d := newTestDisk(t, dir)
+	if err := os.WriteFile(d.path, []byte("not a snapshot"), 0o644); err != nil {
+		t.Fatalf("writing snapshot: %v", err)
+	}
+
+	if err := NewDisk(d.cfg).Init(context.Background()); err == nil {
+		t.Error("corrupt snapshot was loaded without an error")
+	}
+}
@@ -0,0 +1,115 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/meilisearch/meilisearch-go"
+	"michiru/models"
+)
+
+// historyDocument is an import report as stored in Meilisearch, with a
+// numeric timestamp to sort reports by.
+type historyDocument struct {
+	models.ImportReport
+	Timestamp int64 `json:"timestamp"`
+}
+
+// createHistoryIndex creates an import history index with the given uid,
+// sortable by the start time of each report.
+func (m *Meilisearch) createHistoryIndex(ctx context.Context, uid string) error {
+	if err := m.createIndex(ctx, uid, "id"); err != nil {
+		return err
+	}
+
+	return m.updateHistoryIndexSettings(ctx, uid)
+}
+
+// updateHistoryIndexSettings applies the settings used for all import history
+// indexes to the index with the given uid.
+func (m *Meilisearch) updateHistoryIndexSettings(
+	ctx context.Context, uid string,
+) error {
+	c := m.client
+
+	task, err := c.Index(uid).UpdateSettingsWithContext(
+		ctx, &meilisearch.Settings{
+			SortableAttributes: []string{"timestamp"},
+			Pagination:         &meilisearch.Pagination{MaxTotalHits: maxLogHits},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error updating index settings: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, task.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("error waiting for settings update: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Meilisearch) AddImportReport(
+	ctx context.Context, report models.ImportReport,
+) error {
+	c := m.client
+	idx := c.Index(historyIndexName(m.cfg.IndexName))
+
+	doc := historyDocument{
+		ImportReport: report,
+		Timestamp:    report.StartedAt.UnixMilli(),
+	}
+	task, err := idx.AddDocumentsWithContext(ctx, []historyDocument{doc})
+	if err != nil {
+		return fmt.Errorf("error creating report insertion task: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, task.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf(
+			"error waiting for report insertion task completion: %w", err,
+		)
+	}
+
+	return nil
+}
+
+func (m *Meilisearch) GetImportReports(
+	ctx context.Context, offset int, limit int,
+) ([]models.ImportReport, int, error) {
+	c := m.client
+	idx := c.Index(historyIndexName(m.cfg.IndexName))
+
+	res, err := idx.SearchWithContext(
+		ctx, "", &meilisearch.SearchRequest{
+			Offset: int64(offset),
+			Limit:  int64(limit),
+			Sort:   []string{"timestamp:desc"},
+		},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return make([]models.ImportReport, 0), 0, nil
+		}
+		return nil, 0, fmt.Errorf("error getting import reports: %w", err)
+	}
+
+	var docs []historyDocument
+	if err = decodeHits(ctx, res.Hits, &docs); err != nil {
+		return nil, 0, err
+	}
+
+	reports := make([]models.ImportReport, 0, len(docs))
+	for _, doc := range docs {
+		reports = append(reports, doc.ImportReport)
+	}
+
+	return reports, int(res.EstimatedTotalHits), nil
+}
+
+// historyIndexName returns the uid of the import history index belonging to
+// the title index with the given uid.
+func historyIndexName(uid string) string {
+	return uid + "_history"
+}
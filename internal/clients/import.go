@@ -0,0 +1,408 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+	"michiru/models"
+)
+
+// meilisearchStaging is a fresh title index populated in batches during an
+// import, which is atomically swapped with the search index defined by
+// config.IndexName once complete. Until Commit succeeds, the currently served
+// index is untouched.
+type meilisearchStaging struct {
+	m     *Meilisearch
+	ctx   context.Context
+	uid   string
+	batch []models.AnimeDocument
+}
+
+// NewStagingIndex creates an empty staging title index, with its hash index and
+// flat title index.
+func (m *Meilisearch) NewStagingIndex(
+	ctx context.Context,
+) (StagingIndex, error) {
+	s := &meilisearchStaging{
+		m:     m,
+		ctx:   ctx,
+		uid:   fmt.Sprintf("%s_%d", m.cfg.IndexName, time.Now().Unix()),
+		batch: make([]models.AnimeDocument, 0, m.cfg.ImportBatchSize),
+	}
+
+	slog.InfoContext(ctx, "Creating staging index", "uid", s.uid)
+
+	if err := m.createTitleIndex(ctx, s.uid); err != nil {
+		return nil, fmt.Errorf("error creating staging index: %w", err)
+	}
+
+	err := m.createIndex(ctx, hashIndexName(s.uid), "aid")
+	if err != nil {
+		s.Discard()
+		return nil, fmt.Errorf("error creating staging hash index: %w", err)
+	}
+
+	err = m.createFlatIndex(ctx, flatIndexName(s.uid))
+	if err != nil {
+		s.Discard()
+		return nil, fmt.Errorf("error creating staging flat index: %w", err)
+	}
+
+	return s, nil
+}
+
+// Add queues the document for insertion, submitting a batch to Meilisearch
+// whenever config.ImportBatchSize documents are queued.
+func (s *meilisearchStaging) Add(doc models.AnimeDocument) error {
+	s.batch = append(s.batch, doc)
+	if len(s.batch) < s.m.cfg.ImportBatchSize {
+		return nil
+	}
+
+	return s.flush()
+}
+
+func (s *meilisearchStaging) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+
+	c := s.m.client
+	idx := c.Index(s.uid)
+
+	addTask, err := idx.AddDocumentsWithContext(s.ctx, s.batch)
+	if err != nil {
+		return fmt.Errorf("error creating document insertion task: %w", err)
+	}
+
+	res, err := s.m.waitForTask(s.ctx, addTask.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf(
+			"error waiting for document insertion task completion: %w", err,
+		)
+	}
+
+	err = s.m.addFlatTitles(s.ctx, flatIndexName(s.uid), s.batch)
+	if err != nil {
+		return err
+	}
+
+	err = s.m.upsertHashes(s.ctx, hashIndexName(s.uid), s.batch)
+	if err != nil {
+		return err
+	}
+
+	s.batch = s.batch[:0]
+	return nil
+}
+
+// Commit submits any queued documents, verifies the document count against
+// meta.DumpEntries and swaps the staging indexes into place.
+func (s *meilisearchStaging) Commit(meta *models.MetadataDocument) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	c := s.m.client
+
+	stats, err := c.Index(s.uid).GetStatsWithContext(s.ctx)
+	if err != nil {
+		return fmt.Errorf("error getting staging index stats: %w", err)
+	}
+	if meta != nil && stats.NumberOfDocuments != meta.DumpEntries {
+		return fmt.Errorf(
+			"staging index has %d documents, expected %d",
+			stats.NumberOfDocuments, meta.DumpEntries,
+		)
+	}
+
+	slog.InfoContext(s.ctx, "Swapping staging index into place", "uid", s.uid)
+
+	swapTask, err := c.SwapIndexesWithContext(
+		s.ctx, []*meilisearch.SwapIndexesParams{
+			{Indexes: []string{s.m.cfg.IndexName, s.uid}},
+			{
+				Indexes: []string{
+					hashIndexName(s.m.cfg.IndexName), hashIndexName(s.uid),
+				},
+			},
+			{
+				Indexes: []string{
+					flatIndexName(s.m.cfg.IndexName), flatIndexName(s.uid),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error creating index swap task: %w", err)
+	}
+
+	res, err := s.m.waitForTask(s.ctx, swapTask.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("error waiting for index swap completion: %w", err)
+	}
+
+	return nil
+}
+
+// Discard deletes the indexes under the staging names: either the unused
+// staging indexes, or the previously served indexes after a Commit.
+func (s *meilisearchStaging) Discard() {
+	// Clean up even if the import itself was cancelled
+	ctx := context.WithoutCancel(s.ctx)
+
+	uids := []string{s.uid, hashIndexName(s.uid), flatIndexName(s.uid)}
+	for _, uid := range uids {
+		if err := s.m.deleteIndex(ctx, uid); err != nil {
+			slog.WarnContext(ctx, "Could not delete index", "error", err)
+		}
+	}
+}
+
+// UpdateAnime upserts the supplied anime into the search index defined by
+// config.IndexName and deletes the removed aids from it.
+// Stored hashes are only updated once the search index has been updated, so a
+// failed run is picked up again by the next import.
+func (m *Meilisearch) UpdateAnime(
+	ctx context.Context, upserts []models.AnimeDocument,
+	removed []string, meta *models.MetadataDocument,
+) error {
+	c := m.client
+	idx := c.Index(m.cfg.IndexName)
+
+	if len(upserts) > 0 {
+		slog.InfoContext(ctx, "Upserting anime", "anime", len(upserts))
+
+		addTask, err := idx.AddDocumentsWithContext(ctx, upserts)
+		if err != nil {
+			return fmt.Errorf("error creating document upsert task: %w", err)
+		}
+
+		res, err := m.waitForTask(ctx, addTask.TaskUID)
+		if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+			return fmt.Errorf(
+				"error waiting for document upsert task completion: %w", err,
+			)
+		}
+	}
+
+	if len(removed) > 0 {
+		slog.InfoContext(ctx, "Removing anime", "anime", len(removed))
+
+		deleteTask, err := idx.DeleteDocumentsWithContext(ctx, removed)
+		if err != nil {
+			return fmt.Errorf("error creating document deletion task: %w", err)
+		}
+
+		res, err := m.waitForTask(ctx, deleteTask.TaskUID)
+		if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+			return fmt.Errorf(
+				"error waiting for document deletion task completion: %w", err,
+			)
+		}
+	}
+
+	if err := m.updateFlatTitles(ctx, upserts, removed); err != nil {
+		return err
+	}
+
+	stats, err := idx.GetStatsWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting index stats: %w", err)
+	}
+	if meta != nil && stats.NumberOfDocuments != meta.DumpEntries {
+		slog.WarnContext(
+			ctx, "Index document count differs from dump",
+			"documents", stats.NumberOfDocuments, "expected", meta.DumpEntries,
+		)
+	}
+
+	slog.InfoContext(ctx, "Updating stored anime hashes")
+
+	err = m.upsertHashes(ctx, hashIndexName(m.cfg.IndexName), upserts)
+	if err != nil {
+		return err
+	}
+
+	if len(removed) > 0 {
+		hashIdx := c.Index(hashIndexName(m.cfg.IndexName))
+		deleteTask, err := hashIdx.DeleteDocumentsWithContext(ctx, removed)
+		if err != nil {
+			return fmt.Errorf("error creating hash deletion task: %w", err)
+		}
+
+		res, err := m.waitForTask(ctx, deleteTask.TaskUID)
+		if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+			return fmt.Errorf(
+				"error waiting for hash deletion task completion: %w", err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// updateFlatTitles replaces the titles of the upserted and removed anime in the
+// flat title index defined by config.IndexName.
+func (m *Meilisearch) updateFlatTitles(
+	ctx context.Context, upserts []models.AnimeDocument,
+	removed []string,
+) error {
+	aids := make([]string, 0, len(upserts)+len(removed))
+	for _, doc := range upserts {
+		aids = append(aids, doc.Aid.String())
+	}
+	aids = append(aids, removed...)
+	if len(aids) == 0 {
+		return nil
+	}
+
+	c := m.client
+	idx := c.Index(flatIndexName(m.cfg.IndexName))
+
+	// Anime may have fewer titles than before, so remove all old titles first
+	deleteTask, err := idx.DeleteDocumentsByFilterWithContext(
+		ctx, fmt.Sprintf("aid IN [%s]", strings.Join(aids, ", ")),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating title deletion task: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, deleteTask.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf(
+			"error waiting for title deletion task completion: %w", err,
+		)
+	}
+
+	return m.addFlatTitles(ctx, flatIndexName(m.cfg.IndexName), upserts)
+}
+
+// addFlatTitles adds the titles of the supplied anime to the flat title index
+// with the given uid.
+func (m *Meilisearch) addFlatTitles(
+	ctx context.Context, uid string,
+	anime []models.AnimeDocument,
+) error {
+	titles := make([]models.TitleDocument, 0, len(anime))
+	for _, doc := range anime {
+		titles = append(titles, doc.Titles()...)
+	}
+	if len(titles) == 0 {
+		return nil
+	}
+
+	c := m.client
+	idx := c.Index(uid)
+
+	task, err := idx.AddDocumentsWithContext(ctx, titles)
+	if err != nil {
+		return fmt.Errorf("error creating title insertion task: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, task.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf(
+			"error waiting for title insertion task completion: %w", err,
+		)
+	}
+
+	return nil
+}
+
+// GetAnimeHashes returns the content hashes of all anime stored by the previous
+// import, keyed by aid.
+func (m *Meilisearch) GetAnimeHashes(
+	ctx context.Context,
+) (map[string]string, error) {
+	c := m.client
+	idx := c.Index(hashIndexName(m.cfg.IndexName))
+
+	const pageSize = 1000
+	hashes := make(map[string]string)
+	for offset := int64(0); ; offset += pageSize {
+		var res meilisearch.DocumentsResult
+		err := idx.GetDocumentsWithContext(
+			ctx, &meilisearch.DocumentsQuery{
+				Offset: offset,
+				Limit:  pageSize,
+			}, &res,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error getting anime hashes: %w", err)
+		}
+
+		b, err := json.Marshal(res.Results)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []models.AnimeHashDocument
+		err = json.Unmarshal(b, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range page {
+			hashes[h.Aid.String()] = h.Hash
+		}
+
+		if offset+pageSize >= res.Total {
+			break
+		}
+	}
+
+	return hashes, nil
+}
+
+// upsertHashes stores the content hashes of the supplied anime in the hash
+// index with the given uid.
+func (m *Meilisearch) upsertHashes(
+	ctx context.Context, uid string,
+	anime []models.AnimeDocument,
+) error {
+	if len(anime) == 0 {
+		return nil
+	}
+
+	c := m.client
+	idx := c.Index(uid)
+
+	hashes := make([]models.AnimeHashDocument, 0, len(anime))
+	for _, doc := range anime {
+		hashes = append(
+			hashes, models.AnimeHashDocument{Aid: doc.Aid, Hash: doc.Hash()},
+		)
+	}
+
+	task, err := idx.AddDocumentsWithContext(ctx, hashes)
+	if err != nil {
+		return fmt.Errorf("error creating hash insertion task: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, task.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf(
+			"error waiting for hash insertion task completion: %w", err,
+		)
+	}
+
+	return nil
+}
+
+// flatIndexName returns the name of the flat title index for the title index
+// with the given uid.
+func flatIndexName(uid string) string {
+	return uid + "_flat"
+}
+
+// hashIndexName returns the name of the index storing anime hashes for the
+// title index with the given uid.
+func hashIndexName(uid string) string {
+	return uid + "_hashes"
+}
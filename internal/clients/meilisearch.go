@@ -3,93 +3,68 @@ package clients
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"sync"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/meilisearch/meilisearch-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"michiru/config"
+	"michiru/internal/tracing"
 	"michiru/models"
 )
 
-var (
+// Meilisearch is a SearchBackend storing anime in the Meilisearch instance at
+// config.MeilisearchURL, under indexes named after config.IndexName.
+type Meilisearch struct {
 	client meilisearch.ServiceManager
-	once   sync.Once
-)
-
-func getMeilisearchClient(cfg config.Config) meilisearch.ServiceManager {
-	once.Do(
-		func() {
-			c, err := meilisearch.Connect(
-				cfg.MeilisearchURL, meilisearch.WithAPIKey(cfg.MeilisearchKey),
-			)
-			if err != nil {
-				logger.Fatalf(
-					"FATAL: Could not connect to Meilisearch.\n%v", err,
-				)
-			}
-			client = c
-		},
-	)
-
-	return client
+	cfg    config.Config
 }
 
-// AddAnime adds all supplied models.AnimeDocument into the search index defined by config.IndexName.
-func AddAnime(
-	ctx context.Context, cfg config.Config, anime []models.AnimeDocument,
-) error {
-	c := getMeilisearchClient(cfg)
-	idx := c.Index(cfg.IndexName)
-
-	logger.Println("Resetting Meilisearch index")
-
-	deleteTask, err := idx.DeleteAllDocumentsWithContext(ctx)
-	if err != nil {
-		return fmt.Errorf("error creating document deletion task: %w", err)
-	}
-
-	res, err := c.WaitForTaskWithContext(
-		ctx, deleteTask.TaskUID, cfg.TaskTimeout,
-	)
-	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
-		return fmt.Errorf(
-			"error waiting for document deletion task completion: %w", err,
+func NewMeilisearch(cfg config.Config) (*Meilisearch, error) {
+	if cfg.MeilisearchURL == "" || cfg.MeilisearchKey == "" {
+		return nil, errors.New(
+			"MEILISEARCH_URL and MEILISEARCH_KEY are required for the meilisearch backend",
 		)
 	}
 
-	logger.Println("Updating Meilisearch index")
-
-	addTask, err := idx.AddDocumentsWithContext(ctx, anime)
+	c, err := meilisearch.Connect(
+		cfg.MeilisearchURL, meilisearch.WithAPIKey(cfg.MeilisearchKey),
+		meilisearch.WithCustomClient(
+			&http.Client{
+				Transport: instrumentedTransport{
+					next: tracing.Transport(http.DefaultTransport),
+				},
+			},
+		),
+	)
 	if err != nil {
-		return fmt.Errorf("error creating document insertion task: %w", err)
+		return nil, fmt.Errorf("error connecting to Meilisearch: %w", err)
 	}
 
-	res, err = c.WaitForTaskWithContext(ctx, addTask.TaskUID, cfg.TaskTimeout)
-	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
-		return fmt.Errorf(
-			"error waiting for document insertion task completion: %w", err,
-		)
-	}
-
-	return nil
+	return &Meilisearch{client: c, cfg: cfg}, nil
 }
 
 // UpdateMetadata updates metadata for the index defined by config.IndexName with the supplied document.
-func UpdateMetadata(
-	ctx context.Context, cfg config.Config, meta *models.MetadataDocument,
+func (m *Meilisearch) UpdateMetadata(
+	ctx context.Context, meta *models.MetadataDocument,
 ) error {
-	c := getMeilisearchClient(cfg)
+	c := m.client
 	idx := c.Index("index_metadata")
 
-	logger.Println("Updating metadata")
+	slog.InfoContext(ctx, "Updating metadata")
 
-	meta.Id = fmt.Sprintf("%s", cfg.IndexName)
+	meta.Id = fmt.Sprintf("%s", m.cfg.IndexName)
 	task, err := idx.AddDocuments([]models.MetadataDocument{*meta})
 	if err != nil {
 		return fmt.Errorf("error creating metadata insertion task: %w", err)
 	}
 
-	res, err := c.WaitForTaskWithContext(ctx, task.TaskUID, cfg.TaskTimeout)
+	res, err := m.waitForTask(ctx, task.TaskUID)
 	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
 		return fmt.Errorf(
 			"error waiting for metadata insertion task completion: %w", err,
@@ -99,105 +74,283 @@ func UpdateMetadata(
 	return nil
 }
 
-// InitIndexes sets up required search indexes in Meilisearch.
+// Init sets up required search indexes in Meilisearch.
 // If the indexes already exist, this function does nothing.
-func InitIndexes(ctx context.Context, cfg config.Config) error {
-	c := getMeilisearchClient(cfg)
+func (m *Meilisearch) Init(ctx context.Context) error {
+	c := m.client
 
-	_, notExists := c.GetIndex(cfg.IndexName)
+	_, notExists := c.GetIndex(m.cfg.IndexName)
 	if notExists != nil {
-		logger.Println("Creating search index")
+		slog.InfoContext(ctx, "Creating search index")
 
-		createIndexTask, err := c.CreateIndexWithContext(
-			ctx, &meilisearch.IndexConfig{
-				Uid:        cfg.IndexName,
-				PrimaryKey: "aid",
-			},
-		)
+		if err := m.createTitleIndex(ctx, m.cfg.IndexName); err != nil {
+			return err
+		}
+	} else {
+		// Keep settings of indexes created by older versions up to date
+		err := m.updateTitleIndexSettings(ctx, m.cfg.IndexName)
 		if err != nil {
-			return fmt.Errorf("error creating index: %w", err)
+			return err
 		}
+	}
 
-		res, err := c.WaitForTaskWithContext(
-			ctx, createIndexTask.TaskUID, cfg.TaskTimeout,
-		)
-		if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
-			return fmt.Errorf("error waiting for index creation: %w", err)
+	_, notExists = c.GetIndex(hashIndexName(m.cfg.IndexName))
+	if notExists != nil {
+		slog.InfoContext(ctx, "Creating hash index")
+
+		err := m.createIndex(ctx, hashIndexName(m.cfg.IndexName), "aid")
+		if err != nil {
+			return err
 		}
+	}
 
-		logger.Println("Updating search index settings")
-
-		idx := c.Index(cfg.IndexName)
-		updateTask, err := idx.UpdateSettingsWithContext(
-			ctx, &meilisearch.Settings{
-				DisplayedAttributes: []string{
-					"aid",
-					"mainTitle",
-					"officialTitles",
-					"shortTitles",
-					"synonymousTitles",
-					"kanaTitles",
-					"cardTitles",
-				},
-				// Manually defined to enforce attribute sorting order in order of importance
-				SearchableAttributes: []string{
-					"mainTitle",
-					"officialTitles",
-					"shortTitles",
-					"synonymousTitles",
-					"kanaTitles",
-					"cardTitles",
-				},
-				RankingRules: []string{
-					"words",
-					"exactness",
-					"attribute",
-					"typo",
-					"proximity",
-					"sort",
-				},
-			},
+	_, notExists = c.GetIndex(flatIndexName(m.cfg.IndexName))
+	if notExists != nil {
+		slog.InfoContext(ctx, "Creating flat title index")
+
+		err := m.createFlatIndex(ctx, flatIndexName(m.cfg.IndexName))
+		if err != nil {
+			return err
+		}
+
+		// A new flat index must be populated with every anime, so clear the
+		// stored hashes to make the next import rebuild all indexes
+		err = m.clearIndex(ctx, hashIndexName(m.cfg.IndexName))
+		if err != nil {
+			return err
+		}
+	} else {
+		err := m.updateFlatIndexSettings(ctx, flatIndexName(m.cfg.IndexName))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, notExists = c.GetIndex(changesIndexName(m.cfg.IndexName))
+	if notExists != nil {
+		slog.InfoContext(ctx, "Creating title change index")
+
+		err := m.createChangesIndex(ctx, changesIndexName(m.cfg.IndexName))
+		if err != nil {
+			return err
+		}
+	} else {
+		err := m.updateChangesIndexSettings(
+			ctx, changesIndexName(m.cfg.IndexName),
 		)
 		if err != nil {
-			return fmt.Errorf("error updating index settings: %w", err)
+			return err
 		}
+	}
 
-		res, err = c.WaitForTaskWithContext(
-			ctx, updateTask.TaskUID, cfg.TaskTimeout,
+	_, notExists = c.GetIndex(historyIndexName(m.cfg.IndexName))
+	if notExists != nil {
+		slog.InfoContext(ctx, "Creating import history index")
+
+		err := m.createHistoryIndex(ctx, historyIndexName(m.cfg.IndexName))
+		if err != nil {
+			return err
+		}
+	} else {
+		err := m.updateHistoryIndexSettings(
+			ctx, historyIndexName(m.cfg.IndexName),
 		)
-		if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
-			return fmt.Errorf("error waiting for settings update: %w", err)
+		if err != nil {
+			return err
 		}
 	}
 
 	_, notExists = c.GetIndex("index_metadata")
 	if notExists != nil {
-		logger.Println("Creating metadata index")
+		slog.InfoContext(ctx, "Creating metadata index")
+
+		if err := m.createIndex(ctx, "index_metadata", "id"); err != nil {
+			return err
+		}
+	}
 
-		createIndexTask, err := c.CreateIndexWithContext(
-			ctx, &meilisearch.IndexConfig{
-				Uid:        "index_metadata",
-				PrimaryKey: "id",
+	return nil
+}
+
+// createTitleIndex creates a title search index with the given uid and applies
+// the search settings used for all title indexes.
+func (m *Meilisearch) createTitleIndex(ctx context.Context, uid string) error {
+	if err := m.createIndex(ctx, uid, "aid"); err != nil {
+		return err
+	}
+
+	return m.updateTitleIndexSettings(ctx, uid)
+}
+
+// updateTitleIndexSettings applies the search settings used for all title
+// indexes to the index with the given uid.
+func (m *Meilisearch) updateTitleIndexSettings(
+	ctx context.Context, uid string,
+) error {
+	c := m.client
+
+	slog.InfoContext(ctx, "Updating search index settings", "uid", uid)
+
+	idx := c.Index(uid)
+	updateTask, err := idx.UpdateSettingsWithContext(
+		ctx, &meilisearch.Settings{
+			DisplayedAttributes: []string{
+				"aid",
+				"mainTitle",
+				"mainTitleLang",
+				"officialTitles",
+				"shortTitles",
+				"synonymousTitles",
+				"kanaTitles",
+				"cardTitles",
 			},
+			FilterableAttributes: []string{"aid"},
+			// Manually defined to enforce attribute sorting order in order of importance
+			SearchableAttributes: []string{
+				"mainTitle",
+				"officialTitles",
+				"shortTitles",
+				"synonymousTitles",
+				"kanaTitles",
+				"cardTitles",
+			},
+			RankingRules: []string{
+				"words",
+				"exactness",
+				"attribute",
+				"typo",
+				"proximity",
+				"sort",
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error updating index settings: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, updateTask.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("error waiting for settings update: %w", err)
+	}
+
+	return nil
+}
+
+// createFlatIndex creates a flat title index with the given uid, holding a
+// models.TitleDocument per title to allow filtering by title language and type.
+func (m *Meilisearch) createFlatIndex(ctx context.Context, uid string) error {
+	if err := m.createIndex(ctx, uid, "id"); err != nil {
+		return err
+	}
+
+	return m.updateFlatIndexSettings(ctx, uid)
+}
+
+// updateFlatIndexSettings applies the search settings used for all flat title
+// indexes to the index with the given uid.
+func (m *Meilisearch) updateFlatIndexSettings(
+	ctx context.Context, uid string,
+) error {
+	c := m.client
+
+	slog.InfoContext(ctx, "Updating flat title index settings", "uid", uid)
+
+	// Only return the best matching title of each anime
+	distinct := "aid"
+
+	idx := c.Index(uid)
+	updateTask, err := idx.UpdateSettingsWithContext(
+		ctx, &meilisearch.Settings{
+			DisplayedAttributes:  []string{"aid", "title", "lang", "type"},
+			SearchableAttributes: []string{"title"},
+			FilterableAttributes: []string{"aid", "lang", "type"},
+			DistinctAttribute:    &distinct,
+			RankingRules: []string{
+				"words",
+				"exactness",
+				"typo",
+				"proximity",
+				"sort",
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error updating index settings: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, updateTask.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("error waiting for settings update: %w", err)
+	}
+
+	return nil
+}
+
+// clearIndex deletes all documents in the index with the given uid.
+func (m *Meilisearch) clearIndex(ctx context.Context, uid string) error {
+	c := m.client
+
+	task, err := c.Index(uid).DeleteAllDocumentsWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating document deletion task: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, task.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf(
+			"error waiting for document deletion task completion: %w", err,
 		)
-		if err != nil {
-			return fmt.Errorf("error creating index: %w", err)
-		}
+	}
+
+	return nil
+}
+
+// createIndex creates an empty index with the given uid and primary key.
+func (m *Meilisearch) createIndex(
+	ctx context.Context, uid string, primaryKey string,
+) error {
+	c := m.client
+
+	createIndexTask, err := c.CreateIndexWithContext(
+		ctx, &meilisearch.IndexConfig{
+			Uid:        uid,
+			PrimaryKey: primaryKey,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error creating index: %w", err)
+	}
 
-		res, err := c.WaitForTaskWithContext(
-			ctx, createIndexTask.TaskUID, cfg.TaskTimeout,
+	res, err := m.waitForTask(ctx, createIndexTask.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("error waiting for index creation: %w", err)
+	}
+
+	return nil
+}
+
+// deleteIndex deletes the index with the given uid and waits for completion.
+func (m *Meilisearch) deleteIndex(ctx context.Context, uid string) error {
+	c := m.client
+
+	task, err := c.DeleteIndexWithContext(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("error submitting delete index task: %w", err)
+	}
+
+	res, err := m.waitForTask(ctx, task.TaskUID)
+	if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf(
+			"error waiting for index deletion task completion: %w", err,
 		)
-		if err != nil || res.Status != meilisearch.TaskStatusSucceeded {
-			return fmt.Errorf("error waiting for index creation: %w", err)
-		}
 	}
 
 	return nil
 }
 
-// ResetIndexes deletes ALL indexes in the connected Meilisearch instance.
-func ResetIndexes(ctx context.Context, cfg config.Config) error {
-	c := getMeilisearchClient(cfg)
+// Reset deletes ALL indexes in the connected Meilisearch instance.
+func (m *Meilisearch) Reset(ctx context.Context) error {
+	c := m.client
 	res, _ := c.ListIndexes(
 		&meilisearch.IndexesQuery{
 			Limit:  20,
@@ -206,32 +359,26 @@ func ResetIndexes(ctx context.Context, cfg config.Config) error {
 	)
 
 	for _, index := range res.Results {
-		task, err := c.DeleteIndexWithContext(ctx, index.UID)
-		if err != nil {
-			return fmt.Errorf("error submitting delete index task: %w", err)
-		}
-
-		cTask, err := c.WaitForTaskWithContext(
-			ctx, task.TaskUID, cfg.TaskTimeout,
-		)
-		if err != nil || cTask.Status != meilisearch.TaskStatusSucceeded {
-			return fmt.Errorf(
-				"error waiting for index deletion task completion: %w", err,
-			)
+		if err := m.deleteIndex(ctx, index.UID); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func SearchAnime(
-	cfg config.Config, params *models.QueryParams,
+func (m *Meilisearch) SearchAnime(
+	ctx context.Context, params *models.QueryParams,
 ) ([]models.AnimeSearchDocument, int, error) {
-	c := getMeilisearchClient(cfg)
-	idx := c.Index(cfg.IndexName)
+	if len(params.Langs) > 0 || len(params.Types) > 0 {
+		return m.searchFlatTitles(ctx, params)
+	}
+
+	c := m.client
+	idx := c.Index(m.cfg.IndexName)
 
-	res, err := idx.Search(
-		params.Query, &meilisearch.SearchRequest{
+	res, err := idx.SearchWithContext(
+		ctx, params.Query, &meilisearch.SearchRequest{
 			Offset:                int64(params.Offset),
 			Limit:                 int64(params.Limit),
 			AttributesToHighlight: []string{"*"},
@@ -244,30 +391,144 @@ func SearchAnime(
 		return nil, 0, err
 	}
 
-	b, err := json.Marshal(res.Hits)
-	if err != nil {
+	var results []models.AnimeSearchDocument
+	if err = decodeHits(ctx, res.Hits, &results); err != nil {
 		return nil, 0, err
 	}
 
-	var results []models.AnimeSearchDocument
-	err = json.Unmarshal(b, &results)
+	return results, int(res.EstimatedTotalHits), nil
+}
+
+// searchFlatTitles searches only titles in the languages and of the types given
+// in params, using the flat title index. Each anime is returned with only those
+// titles, with the best matching title highlighted.
+func (m *Meilisearch) searchFlatTitles(
+	ctx context.Context, params *models.QueryParams,
+) ([]models.AnimeSearchDocument, int, error) {
+	c := m.client
+	idx := c.Index(flatIndexName(m.cfg.IndexName))
+
+	filters := make([]string, 0, 2)
+	if len(params.Langs) > 0 {
+		filters = append(filters, "lang IN "+filterList(params.Langs))
+	}
+	if len(params.Types) > 0 {
+		filters = append(filters, "type IN "+filterList(params.Types))
+	}
+
+	res, err := idx.SearchWithContext(
+		ctx, params.Query, &meilisearch.SearchRequest{
+			Offset:                int64(params.Offset),
+			Limit:                 int64(params.Limit),
+			Filter:                strings.Join(filters, " AND "),
+			AttributesToHighlight: []string{"title"},
+			HighlightPreTag:       "<span>",
+			HighlightPostTag:      "</span>",
+			ShowRankingScore:      true,
+		},
+	)
 	if err != nil {
 		return nil, 0, err
 	}
 
+	var hits []models.TitleSearchDocument
+	if err = decodeHits(ctx, res.Hits, &hits); err != nil {
+		return nil, 0, err
+	}
+
+	aids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		aids = append(aids, hit.Aid.String())
+	}
+
+	anime := make(map[string]models.AnimeDocument)
+	if len(aids) > 0 {
+		anime, err = m.GetAnimeBatch(ctx, aids)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	results := make([]models.AnimeSearchDocument, 0, len(hits))
+	for _, hit := range hits {
+		doc, ok := anime[hit.Aid.String()]
+		if !ok {
+			continue
+		}
+
+		result := models.AnimeSearchDocument{
+			AnimeDocument: doc.FilterTitles(params.Langs, params.Types),
+			Formatted:     doc.FilterTitles(params.Langs, params.Types),
+			RankingScore:  hit.RankingScore,
+		}
+		result.Formatted.SetTitle(
+			hit.Type, hit.Lang, hit.Title, hit.Formatted.Title,
+		)
+		results = append(results, result)
+	}
+
 	return results, int(res.EstimatedTotalHits), nil
 }
 
-func GetMetadata(
-	ctx context.Context, cfg config.Config,
+// SuggestTitles returns the best matching title of each of the top anime for a
+// prefix query, using the flat title index. The index is distinct by aid, so
+// Meilisearch ranks the titles and keeps the best of each anime itself, which
+// is simpler than picking a title from the _matchesPosition of anime hits.
+func (m *Meilisearch) SuggestTitles(
+	ctx context.Context, query string, limit int,
+) ([]models.Suggestion, error) {
+	c := m.client
+	idx := c.Index(flatIndexName(m.cfg.IndexName))
+
+	res, err := idx.SearchWithContext(
+		ctx, query, &meilisearch.SearchRequest{
+			Limit:                int64(limit),
+			AttributesToRetrieve: []string{"aid", "title", "lang", "type"},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []models.TitleDocument
+	if err = decodeHits(ctx, res.Hits, &hits); err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]models.Suggestion, 0, len(hits))
+	for _, hit := range hits {
+		suggestions = append(
+			suggestions, models.Suggestion{
+				Aid:          hit.Aid,
+				MatchedTitle: hit.Title,
+				Lang:         hit.Lang,
+				Type:         hit.Type,
+			},
+		)
+	}
+
+	return suggestions, nil
+}
+
+// filterList formats values as a quoted Meilisearch filter array.
+func filterList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func (m *Meilisearch) GetMetadata(
+	ctx context.Context,
 ) (*models.MetadataDocument, error) {
-	c := getMeilisearchClient(cfg)
+	c := m.client
 	idx := c.Index("index_metadata")
 
 	var meta models.MetadataDocument
-	err := idx.GetDocumentWithContext(ctx, cfg.IndexName, nil, &meta)
+	err := idx.GetDocumentWithContext(ctx, m.cfg.IndexName, nil, &meta)
 	if err != nil {
-		if err.(*meilisearch.Error).StatusCode == 404 {
+		if isNotFound(err) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("error getting metadata: %w", err)
@@ -275,3 +536,112 @@ func GetMetadata(
 
 	return &meta, nil
 }
+
+// GetAnime returns the anime with the given aid, or nil if it does not exist.
+func (m *Meilisearch) GetAnime(
+	ctx context.Context, aid string,
+) (*models.AnimeDocument, error) {
+	c := m.client
+	idx := c.Index(m.cfg.IndexName)
+
+	var anime models.AnimeDocument
+	err := idx.GetDocumentWithContext(ctx, aid, nil, &anime)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting anime: %w", err)
+	}
+
+	return &anime, nil
+}
+
+// Ping checks that the Meilisearch instance is reachable and available.
+func (m *Meilisearch) Ping(ctx context.Context) error {
+	health, err := m.client.HealthWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to Meilisearch: %w", err)
+	}
+	if health.Status != "available" {
+		return fmt.Errorf("Meilisearch is %s", health.Status)
+	}
+
+	return nil
+}
+
+// CountAnime returns the number of documents in the search index defined by
+// config.IndexName.
+func (m *Meilisearch) CountAnime(ctx context.Context) (int64, error) {
+	c := m.client
+
+	stats, err := c.Index(m.cfg.IndexName).GetStatsWithContext(ctx)
+	if err != nil {
+		if isNotFound(err) {
+			return 0, fmt.Errorf("index %q does not exist", m.cfg.IndexName)
+		}
+		return 0, fmt.Errorf("error getting index stats: %w", err)
+	}
+
+	return stats.NumberOfDocuments, nil
+}
+
+// GetAnimeBatch returns the anime with the given aids keyed by aid, fetched
+// with a single filtered request. Unknown aids are absent from the result.
+func (m *Meilisearch) GetAnimeBatch(
+	ctx context.Context, aids []string,
+) (map[string]models.AnimeDocument, error) {
+	c := m.client
+	idx := c.Index(m.cfg.IndexName)
+
+	var res meilisearch.DocumentsResult
+	err := idx.GetDocumentsWithContext(
+		ctx, &meilisearch.DocumentsQuery{
+			Limit:  int64(len(aids)),
+			Filter: fmt.Sprintf("aid IN [%s]", strings.Join(aids, ", ")),
+		}, &res,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting anime: %w", err)
+	}
+
+	b, err := json.Marshal(res.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.AnimeDocument
+	err = json.Unmarshal(b, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	anime := make(map[string]models.AnimeDocument, len(results))
+	for _, doc := range results {
+		anime[doc.Aid.String()] = doc
+	}
+
+	return anime, nil
+}
+
+// decodeHits decodes search hits into v. The client only returns hits as
+// generic maps, so they are re-encoded, which is traced as it grows with the
+// number and size of hits.
+func decodeHits(ctx context.Context, hits []interface{}, v any) error {
+	_, span := tracer.Start(
+		ctx, "Meilisearch.decodeHits",
+		trace.WithAttributes(attribute.Int("meilisearch.hits", len(hits))),
+	)
+	defer span.End()
+
+	b, err := json.Marshal(hits)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// isNotFound reports whether err is a Meilisearch 404 response.
+func isNotFound(err error) bool {
+	var meiliErr *meilisearch.Error
+	return errors.As(err, &meiliErr) && meiliErr.StatusCode == 404
+}
@@ -0,0 +1,654 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"michiru/config"
+	"michiru/models"
+)
+
+// Memory is a SearchBackend keeping all anime in process memory, with a simple
+// fuzzy title search. Its contents are lost when the process exits, so it is
+// mainly useful for development and tests.
+type Memory struct {
+	cfg config.Config
+
+	mu     sync.RWMutex
+	anime  map[string]models.AnimeDocument
+	titles []memoryTitle
+	// Trigram index of title words, mapping each trigram to the indexes of
+	// the titles containing it
+	grams map[string][]int32
+	meta  *models.MetadataDocument
+	// Title changes, oldest first
+	changes []models.TitleChange
+	// Import reports, most recent first
+	history []models.ImportReport
+}
+
+// memoryTitle is a title with its normalised words, precomputed for searching.
+type memoryTitle struct {
+	models.TitleDocument
+	words []string
+}
+
+func NewMemory(cfg config.Config) *Memory {
+	return &Memory{
+		cfg:    cfg,
+		anime:  make(map[string]models.AnimeDocument),
+		titles: make([]memoryTitle, 0),
+		grams:  make(map[string][]int32),
+	}
+}
+
+func (m *Memory) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Reset(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.anime = make(map[string]models.AnimeDocument)
+	m.titles = make([]memoryTitle, 0)
+	m.grams = make(map[string][]int32)
+	m.meta = nil
+	m.changes = nil
+	m.history = nil
+
+	return nil
+}
+
+func (m *Memory) GetAnimeHashes(ctx context.Context) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hashes := make(map[string]string, len(m.anime))
+	for aid, doc := range m.anime {
+		hashes[aid] = doc.Hash()
+	}
+
+	return hashes, nil
+}
+
+func (m *Memory) NewStagingIndex(ctx context.Context) (StagingIndex, error) {
+	return &memoryStaging{
+		m:     m,
+		anime: make(map[string]models.AnimeDocument),
+	}, nil
+}
+
+func (m *Memory) UpdateAnime(
+	ctx context.Context, upserts []models.AnimeDocument, removed []string,
+	meta *models.MetadataDocument,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, doc := range upserts {
+		m.anime[doc.Aid.String()] = doc
+	}
+	for _, aid := range removed {
+		delete(m.anime, aid)
+	}
+	m.rebuildTitles()
+
+	if meta != nil && int64(len(m.anime)) != meta.DumpEntries {
+		slog.WarnContext(
+			ctx, "Index document count differs from dump",
+			"documents", len(m.anime), "expected", meta.DumpEntries,
+		)
+	}
+
+	return nil
+}
+
+// rebuildTitles recomputes the searchable titles of all anime, in aid order,
+// and their trigram index. The caller must hold the write lock.
+func (m *Memory) rebuildTitles() {
+	aids := make([]string, 0, len(m.anime))
+	for aid := range m.anime {
+		aids = append(aids, aid)
+	}
+	sort.Slice(
+		aids, func(i, j int) bool {
+			a, _ := strconv.Atoi(aids[i])
+			b, _ := strconv.Atoi(aids[j])
+			return a < b
+		},
+	)
+
+	m.titles = make([]memoryTitle, 0, len(m.titles))
+	m.grams = make(map[string][]int32, len(m.grams))
+	for _, aid := range aids {
+		for _, title := range m.anime[aid].Titles() {
+			i := int32(len(m.titles))
+			words := normaliseWords(title.Title)
+			for _, word := range words {
+				for _, gram := range wordGrams(word, true) {
+					// Titles are added in order, so duplicates are adjacent
+					postings := m.grams[gram]
+					if len(postings) == 0 || postings[len(postings)-1] != i {
+						m.grams[gram] = append(postings, i)
+					}
+				}
+			}
+
+			m.titles = append(
+				m.titles, memoryTitle{TitleDocument: title, words: words},
+			)
+		}
+	}
+}
+
+func (m *Memory) SearchAnime(
+	ctx context.Context, params *models.QueryParams,
+) ([]models.AnimeSearchDocument, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	query := normaliseWords(params.Query)
+	hits := m.search(query, params.Langs, params.Types)
+
+	results := make([]models.AnimeSearchDocument, 0, params.Limit)
+	for i := params.Offset; i < len(hits) && i < params.Offset+params.Limit; i++ {
+		doc := m.anime[hits[i].title.Aid.String()]
+		filtered := doc.FilterTitles(params.Langs, params.Types)
+
+		results = append(
+			results, models.AnimeSearchDocument{
+				AnimeDocument: filtered,
+				Formatted:     highlightDocument(filtered, query),
+				RankingScore:  hits[i].score(len(query)),
+			},
+		)
+	}
+
+	return results, len(hits), nil
+}
+
+func (m *Memory) SuggestTitles(
+	ctx context.Context, query string, limit int,
+) ([]models.Suggestion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hits := m.search(normaliseWords(query), nil, nil)
+
+	suggestions := make([]models.Suggestion, 0, limit)
+	for i := 0; i < len(hits) && i < limit; i++ {
+		suggestions = append(
+			suggestions, models.Suggestion{
+				Aid:          hits[i].title.Aid,
+				MatchedTitle: hits[i].title.Title,
+				Lang:         hits[i].title.Lang,
+				Type:         hits[i].title.Type,
+			},
+		)
+	}
+
+	return suggestions, nil
+}
+
+func (m *Memory) GetAnime(
+	ctx context.Context, aid string,
+) (*models.AnimeDocument, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	doc, ok := m.anime[aid]
+	if !ok {
+		return nil, nil
+	}
+	return &doc, nil
+}
+
+func (m *Memory) GetAnimeBatch(
+	ctx context.Context, aids []string,
+) (map[string]models.AnimeDocument, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	anime := make(map[string]models.AnimeDocument, len(aids))
+	for _, aid := range aids {
+		if doc, ok := m.anime[aid]; ok {
+			anime[aid] = doc
+		}
+	}
+
+	return anime, nil
+}
+
+// Ping always succeeds, as the index is held in process.
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) CountAnime(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return int64(len(m.anime)), nil
+}
+
+func (m *Memory) GetMetadata(
+	ctx context.Context,
+) (*models.MetadataDocument, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.meta == nil {
+		return nil, nil
+	}
+	meta := *m.meta
+	return &meta, nil
+}
+
+func (m *Memory) UpdateMetadata(
+	ctx context.Context, meta *models.MetadataDocument,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	meta.Id = m.cfg.IndexName
+	stored := *meta
+	m.meta = &stored
+
+	return nil
+}
+
+func (m *Memory) AddTitleChanges(
+	ctx context.Context, changes []models.TitleChange,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Changes recorded again replace the earlier ones, like documents with
+	// the same id in Meilisearch. The new changes are the latest, so are
+	// appended to keep the log sorted by time.
+	ids := make(map[string]bool, len(changes))
+	for _, change := range changes {
+		ids[change.Id] = true
+	}
+	m.changes = slices.DeleteFunc(
+		m.changes, func(change models.TitleChange) bool {
+			return ids[change.Id]
+		},
+	)
+	m.changes = append(m.changes, changes...)
+
+	return nil
+}
+
+func (m *Memory) GetAnimeTitleChanges(
+	ctx context.Context, aid string,
+) ([]models.TitleChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	changes := make([]models.TitleChange, 0)
+	for _, change := range m.changes {
+		if change.Aid.String() == aid {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+func (m *Memory) GetTitleChanges(
+	ctx context.Context, since time.Time, offset int, limit int,
+) ([]models.TitleChange, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Changes are added in import order, so they are sorted by time
+	first, _ := slices.BinarySearchFunc(
+		m.changes, since, func(change models.TitleChange, t time.Time) int {
+			if change.ChangedAt.After(t) {
+				return 1
+			}
+			return -1
+		},
+	)
+	after := m.changes[first:]
+
+	start := min(offset, len(after))
+	end := min(offset+limit, len(after))
+	return slices.Clone(after[start:end]), len(after), nil
+}
+
+func (m *Memory) AddImportReport(
+	ctx context.Context, report models.ImportReport,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, _ := slices.BinarySearchFunc(
+		m.history, report, func(a, b models.ImportReport) int {
+			return b.StartedAt.Compare(a.StartedAt)
+		},
+	)
+	m.history = slices.Insert(m.history, i, report)
+
+	return nil
+}
+
+func (m *Memory) GetImportReports(
+	ctx context.Context, offset int, limit int,
+) ([]models.ImportReport, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := min(offset, len(m.history))
+	end := min(offset+limit, len(m.history))
+	return slices.Clone(m.history[start:end]), len(m.history), nil
+}
+
+// memoryStaging collects all anime of a full rebuild, replacing the anime of
+// the Memory backend on Commit.
+type memoryStaging struct {
+	m     *Memory
+	anime map[string]models.AnimeDocument
+}
+
+func (s *memoryStaging) Add(doc models.AnimeDocument) error {
+	s.anime[doc.Aid.String()] = doc
+	return nil
+}
+
+func (s *memoryStaging) Commit(meta *models.MetadataDocument) error {
+	if meta != nil && int64(len(s.anime)) != meta.DumpEntries {
+		return fmt.Errorf(
+			"staging index has %d documents, expected %d",
+			len(s.anime), meta.DumpEntries,
+		)
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.anime = s.anime
+	s.m.rebuildTitles()
+
+	return nil
+}
+
+func (s *memoryStaging) Discard() {}
+
+// memoryHit is the best matching title of an anime for a query.
+type memoryHit struct {
+	title   *memoryTitle
+	matched int
+	exact   int
+	typos   int
+	rank    int
+}
+
+// less orders hits similarly to the ranking rules of the Meilisearch backend:
+// by matched words, exactness, title type importance and then typos.
+func (h memoryHit) less(o memoryHit) bool {
+	if h.matched != o.matched {
+		return h.matched > o.matched
+	}
+	if h.exact != o.exact {
+		return h.exact > o.exact
+	}
+	if h.rank != o.rank {
+		return h.rank < o.rank
+	}
+	return h.typos < o.typos
+}
+
+// score returns a ranking score between 0 and 1 for a query of n words.
+func (h memoryHit) score(n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	score := float64(h.matched)/float64(n) -
+		0.1*float64(h.matched-h.exact)/float64(n) -
+		0.05*float64(h.typos)/float64(n)
+	return max(score, 0)
+}
+
+// search returns the best matching title of each anime matching at least one
+// query word, restricted to the given languages and types, ordered best first.
+// The caller must hold the read lock.
+func (m *Memory) search(query []string, langs []string, types []string) []memoryHit {
+	if len(query) == 0 {
+		return make([]memoryHit, 0)
+	}
+
+	best := make(map[string]memoryHit)
+	order := make([]string, 0)
+	for _, i := range m.candidates(query) {
+		title := &m.titles[i]
+		if len(langs) > 0 && !slices.Contains(langs, title.Lang) {
+			continue
+		}
+		if len(types) > 0 && !slices.Contains(types, title.Type) {
+			continue
+		}
+
+		hit := memoryHit{
+			title: title,
+			rank:  slices.Index(models.TitleTypes, title.Type),
+		}
+		for j, q := range query {
+			// The last query word may still be being typed
+			exact, typos, ok := matchWord(q, title.words, j == len(query)-1)
+			if !ok {
+				continue
+			}
+			hit.matched++
+			hit.typos += typos
+			if exact {
+				hit.exact++
+			}
+		}
+		if hit.matched == 0 {
+			continue
+		}
+
+		aid := title.Aid.String()
+		prev, seen := best[aid]
+		if !seen {
+			order = append(order, aid)
+		}
+		if !seen || hit.less(prev) {
+			best[aid] = hit
+		}
+	}
+
+	hits := make([]memoryHit, 0, len(order))
+	for _, aid := range order {
+		hits = append(hits, best[aid])
+	}
+	sort.SliceStable(
+		hits, func(i, j int) bool {
+			return hits[i].less(hits[j])
+		},
+	)
+
+	return hits
+}
+
+// candidates returns the indexes of all titles which may match a query word,
+// in ascending order. A word with up to two typos still shares at least one
+// trigram with the word it matches, since the words are padded at both ends.
+// The caller must hold the read lock.
+func (m *Memory) candidates(query []string) []int32 {
+	seen := make(map[int32]bool)
+	for j, q := range query {
+		grams := wordGrams(q, true)
+		if j == len(query)-1 {
+			// Prefix matches only share the trigrams at the start of the word
+			prefixGrams := wordGrams(q, false)
+			if len(prefixGrams) == 0 {
+				// Too short to use the index, so check every title
+				all := make([]int32, len(m.titles))
+				for i := range all {
+					all[i] = int32(i)
+				}
+				return all
+			}
+			grams = append(grams, prefixGrams...)
+		}
+
+		for _, gram := range grams {
+			for _, i := range m.grams[gram] {
+				seen[i] = true
+			}
+		}
+	}
+
+	indexes := make([]int32, 0, len(seen))
+	for i := range seen {
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// wordGrams returns the trigrams of word padded at its start, and also at its
+// end if closed is set.
+func wordGrams(word string, closed bool) []string {
+	runes := append([]rune{'$'}, []rune(word)...)
+	if closed {
+		runes = append(runes, '$')
+	}
+
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+	return grams
+}
+
+// matchWord finds the best match of the query word q among words, allowing
+// typos in longer words like Meilisearch does, and prefix matches if prefix
+// is set.
+func matchWord(q string, words []string, prefix bool) (exact bool, typos int, ok bool) {
+	allowed := 0
+	if n := len([]rune(q)); n >= 9 {
+		allowed = 2
+	} else if n >= 5 {
+		allowed = 1
+	}
+
+	typos = allowed + 1
+	for _, w := range words {
+		if w == q {
+			return true, 0, true
+		}
+		if prefix && strings.HasPrefix(w, q) {
+			typos, ok = 0, true
+			continue
+		}
+		if allowed > 0 {
+			if d := editDistance(q, w, allowed); d < typos {
+				typos, ok = d, true
+			}
+		}
+	}
+
+	return false, typos, ok
+}
+
+// editDistance returns the Levenshtein distance between a and b, or limit+1
+// if it exceeds limit.
+func editDistance(a string, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// normaliseWords splits s into lowercase words of letters and digits.
+func normaliseWords(s string) []string {
+	return strings.FieldsFunc(
+		strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		},
+	)
+}
+
+// highlightDocument returns a copy of doc with words matching the query
+// wrapped in highlight tags, like the _formatted field of Meilisearch hits.
+func highlightDocument(doc models.AnimeDocument, query []string) models.AnimeDocument {
+	formatted := doc.FilterTitles(nil, nil)
+	for _, title := range doc.Titles() {
+		formatted.SetTitle(
+			title.Type, title.Lang, title.Title,
+			highlightTitle(title.Title, query),
+		)
+	}
+	return formatted
+}
+
+// highlightTitle wraps each word of title matching a query word in highlight tags.
+func highlightTitle(title string, query []string) string {
+	var b strings.Builder
+	runes := []rune(title)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsNumber(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsNumber(runes[j])) {
+			j++
+		}
+		word := string(runes[i:j])
+
+		matched := false
+		for k, q := range query {
+			if _, _, ok := matchWord(q, []string{strings.ToLower(word)}, k == len(query)-1); ok {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			b.WriteString("<span>" + word + "</span>")
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	return b.String()
+}
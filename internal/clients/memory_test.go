@@ -0,0 +1,434 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"michiru/config"
+	"michiru/models"
+)
+
+// testAnime is a small set of anime with titles of every kind used by the
+// search tests.
+var testAnime = []models.AnimeDocument{
+	{
+		Aid:           "1",
+		MainTitle:     "Cowboy Bebop",
+		MainTitleLang: "x-jat",
+		OfficialTitles: map[string][]string{
+			"en": {"Cowboy Bebop"},
+			"ja": {"カウボーイビバップ"},
+		},
+	},
+	{
+		Aid:           "2",
+		MainTitle:     "Cowboy Bebop: Tengoku no Tobira",
+		MainTitleLang: "x-jat",
+		OfficialTitles: map[string][]string{
+			"en": {"Cowboy Bebop: The Movie"},
+		},
+	},
+	{
+		Aid:            "3",
+		MainTitle:      "Shingeki no Kyojin",
+		MainTitleLang:  "x-jat",
+		OfficialTitles: map[string][]string{"en": {"Attack on Titan"}},
+		ShortTitles:    map[string][]string{"en": {"AoT"}},
+	},
+	{
+		Aid:              "4",
+		MainTitle:        "Shin Seiki Evangelion",
+		MainTitleLang:    "x-jat",
+		OfficialTitles:   map[string][]string{"en": {"Neon Genesis Evangelion"}},
+		SynonymousTitles: map[string][]string{"en": {"Evangelion"}},
+	},
+	{
+		Aid:            "5",
+		MainTitle:      "Kaze Tachinu",
+		MainTitleLang:  "x-jat",
+		OfficialTitles: map[string][]string{"en": {"The Wind Rises"}},
+	},
+}
+
+func newTestMemory(t *testing.T) *Memory {
+	t.Helper()
+	m := NewMemory(config.Config{IndexName: "anime"})
+	err := m.UpdateAnime(context.Background(), testAnime, nil, nil)
+	if err != nil {
+		t.Fatalf("UpdateAnime: %v", err)
+	}
+	return m
+}
+
+func TestMemorySearchAnime(t *testing.T) {
+	m := newTestMemory(t)
+
+	cases := []struct {
+		name   string
+		params models.QueryParams
+		aids   []string
+		count  int
+	}{
+		{
+			name:   "exact words",
+			params: models.QueryParams{Query: "cowboy bebop", Limit: 10},
+			aids:   []string{"1", "2"},
+			count:  2,
+		},
+		{
+			name:   "more matched words rank first",
+			params: models.QueryParams{Query: "cowboy movie", Limit: 10},
+			aids:   []string{"2", "1"},
+			count:  2,
+		},
+		{
+			name:   "word of main title",
+			params: models.QueryParams{Query: "kyojin", Limit: 10},
+			aids:   []string{"3"},
+			count:  1,
+		},
+		{
+			name:   "prefix of last word",
+			params: models.QueryParams{Query: "shingek", Limit: 10},
+			aids:   []string{"3"},
+			count:  1,
+		},
+		{
+			name:   "one typo in a five letter word",
+			params: models.QueryParams{Query: "atack titan", Limit: 10},
+			aids:   []string{"3"},
+			count:  1,
+		},
+		{
+			name:   "two typos in a ten letter word",
+			params: models.QueryParams{Query: "evangelyun gensis", Limit: 10},
+			aids:   []string{"4"},
+			count:  1,
+		},
+		{
+			name:   "no typos in a short word",
+			params: models.QueryParams{Query: "aoy", Limit: 10},
+			aids:   []string{},
+			count:  0,
+		},
+		{
+			name:   "word of official title",
+			params: models.QueryParams{Query: "wind", Limit: 10},
+			aids:   []string{"5"},
+			count:  1,
+		},
+		{
+			name: "type filter",
+			params: models.QueryParams{
+				Query: "titan", Limit: 10, Types: []string{"main"},
+			},
+			aids:  []string{},
+			count: 0,
+		},
+		{
+			name: "language filter",
+			params: models.QueryParams{
+				Query: "cowboy", Limit: 10, Langs: []string{"en"},
+			},
+			aids:  []string{"1", "2"},
+			count: 2,
+		},
+		{
+			name:   "offset",
+			params: models.QueryParams{Query: "cowboy", Limit: 1, Offset: 1},
+			aids:   []string{"2"},
+			count:  2,
+		},
+		{
+			name:   "offset past the last hit",
+			params: models.QueryParams{Query: "cowboy", Limit: 10, Offset: 5},
+			aids:   []string{},
+			count:  2,
+		},
+		{
+			name:   "empty query",
+			params: models.QueryParams{Query: "  ", Limit: 10},
+			aids:   []string{},
+			count:  0,
+		},
+	}
+	for _, c := range cases {
+		t.Run(
+			c.name, func(t *testing.T) {
+				docs, count, err := m.SearchAnime(context.Background(), &c.params)
+				if err != nil {
+					t.Fatalf("SearchAnime: %v", err)
+				}
+				aids := make([]string, 0, len(docs))
+				for _, doc := range docs {
+					aids = append(aids, doc.Aid.String())
+				}
+				if !slices.Equal(aids, c.aids) || count != c.count {
+					t.Errorf(
+						"got aids %v, count %d, want %v, %d",
+						aids, count, c.aids, c.count,
+					)
+				}
+			},
+		)
+	}
+}
+
+func TestMemorySearchAnimeFormatting(t *testing.T) {
+	m := newTestMemory(t)
+
+	params := models.QueryParams{
+		Query: "atack", Limit: 10, Langs: []string{"en"},
+	}
+	docs, _, err := m.SearchAnime(context.Background(), &params)
+	if err != nil {
+		t.Fatalf("SearchAnime: %v", err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("got %d hits, want 1", len(docs))
+	}
+
+	doc := docs[0]
+	if doc.MainTitle != "" {
+		t.Errorf("main title %q not filtered by language", doc.MainTitle)
+	}
+	got := doc.Formatted.OfficialTitles["en"]
+	want := []string{"<span>Attack</span> on Titan"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got formatted titles %q, want %q", got, want)
+	}
+	if doc.RankingScore <= 0 || doc.RankingScore >= 1 {
+		t.Errorf("got ranking score %v for a typo match", doc.RankingScore)
+	}
+}
+
+func TestMemorySuggestTitles(t *testing.T) {
+	m := newTestMemory(t)
+
+	cases := []struct {
+		query string
+		limit int
+		want  []models.Suggestion
+	}{
+		{
+			query: "cowboy bebop the",
+			limit: 5,
+			want: []models.Suggestion{
+				{
+					Aid: "2", MatchedTitle: "Cowboy Bebop: The Movie",
+					Lang: "en", Type: "official",
+				},
+				{
+					Aid: "1", MatchedTitle: "Cowboy Bebop", Lang: "x-jat",
+					Type: "main",
+				},
+				{
+					Aid: "5", MatchedTitle: "The Wind Rises", Lang: "en",
+					Type: "official",
+				},
+			},
+		},
+		{
+			query: "cowboy",
+			limit: 1,
+			want: []models.Suggestion{
+				{
+					Aid: "1", MatchedTitle: "Cowboy Bebop", Lang: "x-jat",
+					Type: "main",
+				},
+			},
+		},
+		{
+			query: "att",
+			limit: 5,
+			want: []models.Suggestion{
+				{
+					Aid: "3", MatchedTitle: "Attack on Titan", Lang: "en",
+					Type: "official",
+				},
+			},
+		},
+		{query: "xyz", limit: 5, want: []models.Suggestion{}},
+	}
+	for _, c := range cases {
+		got, err := m.SuggestTitles(context.Background(), c.query, c.limit)
+		if err != nil {
+			t.Fatalf("SuggestTitles(%q): %v", c.query, err)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("SuggestTitles(%q) = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestMemoryUpdateAnime(t *testing.T) {
+	m := newTestMemory(t)
+	ctx := context.Background()
+
+	renamed := testAnime[4]
+	renamed.MainTitle = "Kaze Tachinu Movie"
+	err := m.UpdateAnime(
+		ctx, []models.AnimeDocument{renamed}, []string{"1"}, nil,
+	)
+	if err != nil {
+		t.Fatalf("UpdateAnime: %v", err)
+	}
+
+	if doc, _ := m.GetAnime(ctx, "1"); doc != nil {
+		t.Error("removed anime is still stored")
+	}
+	if n, _ := m.CountAnime(ctx); n != int64(len(testAnime)-1) {
+		t.Errorf("got %d anime, want %d", n, len(testAnime)-1)
+	}
+
+	params := models.QueryParams{Query: "cowboy", Limit: 10}
+	docs, _, _ := m.SearchAnime(ctx, &params)
+	if len(docs) != 1 || docs[0].Aid != "2" {
+		t.Errorf("removed anime is still searchable: %v", docs)
+	}
+
+	hashes, _ := m.GetAnimeHashes(ctx)
+	if hashes["5"] != renamed.Hash() {
+		t.Error("hash of updated anime was not changed")
+	}
+}
+
+// testChanges returns title changes made one minute apart, oldest first, with
+// the second and third change made at the same time.
+func testChanges(start time.Time) []models.TitleChange {
+	offsets := []time.Duration{0, time.Minute, time.Minute, 2 * time.Minute}
+	changes := make([]models.TitleChange, 0, len(offsets))
+	for i, offset := range offsets {
+		changes = append(
+			changes, models.TitleChange{
+				Id:        string(rune('a' + i)),
+				Aid:       json.Number("1"),
+				Kind:      models.TitleAdded,
+				ChangedAt: start.Add(offset),
+			},
+		)
+	}
+	return changes
+}
+
+func TestMemoryGetTitleChanges(t *testing.T) {
+	m := NewMemory(config.Config{})
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	changes := testChanges(start)
+	if err := m.AddTitleChanges(ctx, changes[:2]); err != nil {
+		t.Fatalf("AddTitleChanges: %v", err)
+	}
+	if err := m.AddTitleChanges(ctx, changes[2:]); err != nil {
+		t.Fatalf("AddTitleChanges: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		since  time.Time
+		offset int
+		limit  int
+		ids    []string
+		count  int
+	}{
+		{"all", time.Time{}, 0, 10, []string{"a", "b", "c", "d"}, 4},
+		{"first page", time.Time{}, 0, 2, []string{"a", "b"}, 4},
+		{"second page", time.Time{}, 2, 2, []string{"c", "d"}, 4},
+		{"past the end", time.Time{}, 4, 2, []string{}, 4},
+		{"since excludes equal times", start.Add(time.Minute), 0, 10, []string{"d"}, 1},
+		{"since between changes", start.Add(time.Second), 1, 10, []string{"c", "d"}, 3},
+		{"since after all", start.Add(time.Hour), 0, 10, []string{}, 0},
+	}
+	for _, c := range cases {
+		got, count, err := m.GetTitleChanges(ctx, c.since, c.offset, c.limit)
+		if err != nil {
+			t.Fatalf("%s: GetTitleChanges: %v", c.name, err)
+		}
+		ids := make([]string, 0, len(got))
+		for _, change := range got {
+			ids = append(ids, change.Id)
+		}
+		if !slices.Equal(ids, c.ids) || count != c.count {
+			t.Errorf(
+				"%s: got ids %v, count %d, want %v, %d",
+				c.name, ids, count, c.ids, c.count,
+			)
+		}
+	}
+}
+
+func TestMemoryGetImportReports(t *testing.T) {
+	m := NewMemory(config.Config{})
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Reports may be recorded out of order when runs overlap
+	for _, hour := range []int{1, 3, 0, 2} {
+		report := models.ImportReport{
+			Id:        string(rune('0' + hour)),
+			StartedAt: start.Add(time.Duration(hour) * time.Hour),
+		}
+		if err := m.AddImportReport(ctx, report); err != nil {
+			t.Fatalf("AddImportReport: %v", err)
+		}
+	}
+
+	cases := []struct {
+		offset int
+		limit  int
+		ids    []string
+	}{
+		{0, 10, []string{"3", "2", "1", "0"}},
+		{1, 2, []string{"2", "1"}},
+		{3, 2, []string{"0"}},
+		{4, 2, []string{}},
+	}
+	for _, c := range cases {
+		got, count, err := m.GetImportReports(ctx, c.offset, c.limit)
+		if err != nil {
+			t.Fatalf("GetImportReports: %v", err)
+		}
+		ids := make([]string, 0, len(got))
+		for _, report := range got {
+			ids = append(ids, report.Id)
+		}
+		if !slices.Equal(ids, c.ids) || count != 4 {
+			t.Errorf(
+				"offset %d, limit %d: got ids %v, count %d, want %v, 4",
+				c.offset, c.limit, ids, count, c.ids,
+			)
+		}
+	}
+}
+
+func TestMemoryAddTitleChangesReplaces(t *testing.T) {
+	m := NewMemory(config.Config{})
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	changes := testChanges(start)
+	if err := m.AddTitleChanges(ctx, changes); err != nil {
+		t.Fatalf("AddTitleChanges: %v", err)
+	}
+
+	// A retried import records the same changes again, later
+	retried := changes[1]
+	retried.ChangedAt = start.Add(time.Hour)
+	if err := m.AddTitleChanges(ctx, []models.TitleChange{retried}); err != nil {
+		t.Fatalf("AddTitleChanges: %v", err)
+	}
+
+	got, count, _ := m.GetTitleChanges(ctx, time.Time{}, 0, 10)
+	ids := make([]string, 0, len(got))
+	for _, change := range got {
+		ids = append(ids, change.Id)
+	}
+	want := []string{"a", "c", "d", "b"}
+	if !slices.Equal(ids, want) || count != len(want) {
+		t.Errorf("got ids %v, count %d, want %v", ids, count, want)
+	}
+}
@@ -0,0 +1,56 @@
+package clients
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"michiru/internal/metrics"
+)
+
+// instrumentedTransport records the latency and errors of every Meilisearch
+// API call, including task polling.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(
+	req *http.Request,
+) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+
+	path := meilisearchRoute(req.URL.Path)
+	metrics.MeilisearchDuration.WithLabelValues(req.Method, path).Observe(
+		time.Since(start).Seconds(),
+	)
+	if err != nil || res.StatusCode >= 400 {
+		metrics.MeilisearchErrors.WithLabelValues(req.Method, path).Inc()
+	}
+
+	return res, err
+}
+
+// meilisearchRoute replaces the index uids, task uids and document ids in a
+// Meilisearch API path with placeholders, to keep metric cardinality bounded.
+func meilisearchRoute(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "indexes":
+			segments[i] = "{uid}"
+		case "tasks":
+			if _, err := strconv.Atoi(segments[i]); err == nil {
+				segments[i] = "{taskUid}"
+			}
+		case "documents":
+			switch segments[i] {
+			case "fetch", "delete", "delete-batch":
+			default:
+				segments[i] = "{id}"
+			}
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
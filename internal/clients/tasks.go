@@ -0,0 +1,57 @@
+package clients
+
+import (
+	"context"
+
+	"github.com/meilisearch/meilisearch-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TaskObserver is called with each Meilisearch task once it has finished.
+type TaskObserver func(uid int64, taskType string, status string)
+
+type taskObserverKey struct{}
+
+// WithTaskObserver returns a context which reports the Meilisearch tasks waited
+// on with it to observe.
+func WithTaskObserver(ctx context.Context, observe TaskObserver) context.Context {
+	return context.WithValue(ctx, taskObserverKey{}, observe)
+}
+
+// waitForTask waits for the task with the given uid to finish, reporting it to
+// the TaskObserver of ctx, if any.
+func (m *Meilisearch) waitForTask(
+	ctx context.Context, taskUID int64,
+) (*meilisearch.Task, error) {
+	ctx, span := tracer.Start(
+		ctx, "Meilisearch.waitForTask",
+		trace.WithAttributes(attribute.Int64("meilisearch.task_uid", taskUID)),
+	)
+	defer span.End()
+
+	// Note the client treats this argument as its polling interval
+	res, err := m.client.WaitForTaskWithContext(ctx, taskUID, m.cfg.TaskTimeout)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(
+			attribute.String("meilisearch.task_type", string(res.Type)),
+			attribute.String("meilisearch.task_status", string(res.Status)),
+		)
+	}
+
+	if observe, ok := ctx.Value(taskObserverKey{}).(TaskObserver); ok {
+		status := "unknown"
+		taskType := ""
+		if res != nil {
+			status = string(res.Status)
+			taskType = string(res.Type)
+		}
+		observe(taskUID, taskType, status)
+	}
+
+	return res, err
+}
@@ -0,0 +1,237 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"michiru/models"
+)
+
+var tracer = otel.Tracer("michiru/internal/clients")
+
+// startSpan starts a span named after the interface method called.
+func startSpan(
+	ctx context.Context, method string, attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	return tracer.Start(
+		ctx, method,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endSpan records err on span, if any, ends it and returns err.
+func endSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	return err
+}
+
+// Traced returns a SearchBackend starting a span for every call to backend.
+func Traced(backend SearchBackend) SearchBackend {
+	return tracedBackend{backend: backend}
+}
+
+type tracedBackend struct {
+	backend SearchBackend
+}
+
+func (t tracedBackend) Init(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "SearchBackend.Init")
+	return endSpan(span, t.backend.Init(ctx))
+}
+
+func (t tracedBackend) Reset(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "SearchBackend.Reset")
+	return endSpan(span, t.backend.Reset(ctx))
+}
+
+func (t tracedBackend) Ping(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "SearchBackend.Ping")
+	return endSpan(span, t.backend.Ping(ctx))
+}
+
+func (t tracedBackend) GetAnimeHashes(
+	ctx context.Context,
+) (map[string]string, error) {
+	ctx, span := startSpan(ctx, "SearchBackend.GetAnimeHashes")
+	hashes, err := t.backend.GetAnimeHashes(ctx)
+	span.SetAttributes(attribute.Int("hashes", len(hashes)))
+	return hashes, endSpan(span, err)
+}
+
+func (t tracedBackend) NewStagingIndex(
+	ctx context.Context,
+) (StagingIndex, error) {
+	parent := ctx
+	ctx, span := startSpan(ctx, "SearchBackend.NewStagingIndex")
+	staging, err := t.backend.NewStagingIndex(ctx)
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	return tracedStaging{staging: staging, ctx: parent}, endSpan(span, nil)
+}
+
+func (t tracedBackend) UpdateAnime(
+	ctx context.Context, upserts []models.AnimeDocument, removed []string,
+	meta *models.MetadataDocument,
+) error {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.UpdateAnime",
+		attribute.Int("upserts", len(upserts)),
+		attribute.Int("removed", len(removed)),
+	)
+	return endSpan(span, t.backend.UpdateAnime(ctx, upserts, removed, meta))
+}
+
+func (t tracedBackend) SearchAnime(
+	ctx context.Context, params *models.QueryParams,
+) ([]models.AnimeSearchDocument, int, error) {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.SearchAnime",
+		attribute.String("query", params.Query),
+		attribute.Int("limit", params.Limit),
+		attribute.Int("offset", params.Offset),
+		attribute.StringSlice("langs", params.Langs),
+		attribute.StringSlice("types", params.Types),
+	)
+	docs, count, err := t.backend.SearchAnime(ctx, params)
+	span.SetAttributes(attribute.Int("results", count))
+	return docs, count, endSpan(span, err)
+}
+
+func (t tracedBackend) SuggestTitles(
+	ctx context.Context, query string, limit int,
+) ([]models.Suggestion, error) {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.SuggestTitles",
+		attribute.String("query", query), attribute.Int("limit", limit),
+	)
+	suggestions, err := t.backend.SuggestTitles(ctx, query, limit)
+	span.SetAttributes(attribute.Int("results", len(suggestions)))
+	return suggestions, endSpan(span, err)
+}
+
+func (t tracedBackend) GetAnime(
+	ctx context.Context, aid string,
+) (*models.AnimeDocument, error) {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.GetAnime", attribute.String("aid", aid),
+	)
+	doc, err := t.backend.GetAnime(ctx, aid)
+	return doc, endSpan(span, err)
+}
+
+func (t tracedBackend) GetAnimeBatch(
+	ctx context.Context, aids []string,
+) (map[string]models.AnimeDocument, error) {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.GetAnimeBatch", attribute.Int("aids", len(aids)),
+	)
+	anime, err := t.backend.GetAnimeBatch(ctx, aids)
+	return anime, endSpan(span, err)
+}
+
+func (t tracedBackend) CountAnime(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "SearchBackend.CountAnime")
+	count, err := t.backend.CountAnime(ctx)
+	return count, endSpan(span, err)
+}
+
+func (t tracedBackend) GetMetadata(
+	ctx context.Context,
+) (*models.MetadataDocument, error) {
+	ctx, span := startSpan(ctx, "SearchBackend.GetMetadata")
+	meta, err := t.backend.GetMetadata(ctx)
+	return meta, endSpan(span, err)
+}
+
+func (t tracedBackend) UpdateMetadata(
+	ctx context.Context, meta *models.MetadataDocument,
+) error {
+	ctx, span := startSpan(ctx, "SearchBackend.UpdateMetadata")
+	return endSpan(span, t.backend.UpdateMetadata(ctx, meta))
+}
+
+func (t tracedBackend) AddTitleChanges(
+	ctx context.Context, changes []models.TitleChange,
+) error {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.AddTitleChanges",
+		attribute.Int("changes", len(changes)),
+	)
+	return endSpan(span, t.backend.AddTitleChanges(ctx, changes))
+}
+
+func (t tracedBackend) GetAnimeTitleChanges(
+	ctx context.Context, aid string,
+) ([]models.TitleChange, error) {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.GetAnimeTitleChanges",
+		attribute.String("aid", aid),
+	)
+	changes, err := t.backend.GetAnimeTitleChanges(ctx, aid)
+	return changes, endSpan(span, err)
+}
+
+func (t tracedBackend) GetTitleChanges(
+	ctx context.Context, since time.Time, offset int, limit int,
+) ([]models.TitleChange, int, error) {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.GetTitleChanges",
+		attribute.String("since", since.Format(time.RFC3339)),
+		attribute.Int("offset", offset), attribute.Int("limit", limit),
+	)
+	changes, count, err := t.backend.GetTitleChanges(ctx, since, offset, limit)
+	return changes, count, endSpan(span, err)
+}
+
+func (t tracedBackend) AddImportReport(
+	ctx context.Context, report models.ImportReport,
+) error {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.AddImportReport",
+		attribute.String("report_id", report.Id),
+	)
+	return endSpan(span, t.backend.AddImportReport(ctx, report))
+}
+
+func (t tracedBackend) GetImportReports(
+	ctx context.Context, offset int, limit int,
+) ([]models.ImportReport, int, error) {
+	ctx, span := startSpan(
+		ctx, "SearchBackend.GetImportReports",
+		attribute.Int("offset", offset), attribute.Int("limit", limit),
+	)
+	reports, count, err := t.backend.GetImportReports(ctx, offset, limit)
+	return reports, count, endSpan(span, err)
+}
+
+// tracedStaging starts a span for committing a staging index. Adding anime is
+// not traced, as there is one call for every anime in the dump.
+type tracedStaging struct {
+	staging StagingIndex
+	ctx     context.Context
+}
+
+func (t tracedStaging) Add(doc models.AnimeDocument) error {
+	return t.staging.Add(doc)
+}
+
+func (t tracedStaging) Commit(meta *models.MetadataDocument) error {
+	_, span := startSpan(t.ctx, "StagingIndex.Commit")
+	return endSpan(span, t.staging.Commit(meta))
+}
+
+func (t tracedStaging) Discard() {
+	_, span := startSpan(t.ctx, "StagingIndex.Discard")
+	t.staging.Discard()
+	span.End()
+}
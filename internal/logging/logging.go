@@ -0,0 +1,101 @@
+// Package logging sets up the structured logger shared by all michiru
+// packages, which log through the default log/slog logger.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"michiru/config"
+)
+
+// Setup replaces the default logger with one writing to stderr in
+// cfg.LogFormat at cfg.LogLevel. Output of the log package is redirected to it.
+func Setup(cfg config.Config) error {
+	logger, err := New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+	return nil
+}
+
+// New creates a logger writing to w in format, either "json" or "text", which
+// discards records below level.
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf(
+			"invalid log format %q, must be json or text", format,
+		)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Fatal logs err at error level with msg and exits.
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+type attrsKey struct{}
+
+// WithAttrs returns a copy of ctx whose attributes are added to every record
+// logged with it, replacing any previous attributes with the same keys.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := slices.DeleteFunc(
+		slices.Clone(prev), func(a slog.Attr) bool {
+			return slices.ContainsFunc(attrs, func(b slog.Attr) bool {
+				return a.Key == b.Key
+			})
+		},
+	)
+	return context.WithValue(ctx, attrsKey{}, append(merged, attrs...))
+}
+
+// contextHandler adds the attributes set with WithAttrs to each record, along
+// with the ids of the trace span of the context, if any.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,239 @@
+// Package metrics defines the Prometheus metrics exported by michiru.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"michiru/models"
+)
+
+const namespace = "michiru"
+
+// Registry holds all michiru metrics.
+var Registry = prometheus.NewRegistry()
+
+// runtime holds the Go runtime and process metrics, which are only served by
+// Handler as they would clash with those of node_exporter in a textfile.
+var runtime = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route pattern, method and status.",
+		}, []string{"route", "method", "status"},
+	)
+	HTTPDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency, by route pattern, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"},
+	)
+
+	MeilisearchDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "meilisearch_request_duration_seconds",
+			Help:      "Meilisearch API call latency, by method and path.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "path"},
+	)
+	MeilisearchErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "meilisearch_errors_total",
+			Help:      "Failed Meilisearch API calls, by method and path.",
+		}, []string{"method", "path"},
+	)
+
+	SearchResults = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "search_results",
+			Help:      "Number of anime matched per query, by endpoint.",
+			Buckets:   []float64{0, 1, 2, 5, 10, 20, 50, 100, 500, 1000},
+		}, []string{"endpoint"},
+	)
+
+	ImportRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "import_runs_total",
+			Help:      "Import runs, by outcome.",
+		}, []string{"outcome"},
+	)
+	ImportDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "import_duration_seconds",
+			Help:      "Duration of import runs.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+	)
+)
+
+func init() {
+	runtime.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	Registry.MustRegister(
+		HTTPRequests, HTTPDuration,
+		MeilisearchDuration, MeilisearchErrors,
+		SearchResults,
+		ImportRuns, ImportDuration,
+	)
+}
+
+// Handler serves the metrics in Registry along with the runtime metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(
+		prometheus.Gatherers{Registry, runtime}, promhttp.HandlerOpts{},
+	)
+}
+
+// ObserveImport records the outcome and duration of an import run.
+func ObserveImport(report models.ImportReport) {
+	ImportRuns.WithLabelValues(report.Outcome).Inc()
+	ImportDuration.Observe(report.EndedAt.Sub(report.StartedAt).Seconds())
+}
+
+// WriteTextfile writes the metrics in Registry to path in the format read by
+// the node_exporter textfile collector.
+func WriteTextfile(path string) error {
+	return prometheus.WriteToTextfile(path, Registry)
+}
+
+// IndexSource is the part of clients.SearchBackend read by IndexCollector.
+type IndexSource interface {
+	GetMetadata(ctx context.Context) (*models.MetadataDocument, error)
+	CountAnime(ctx context.Context) (int64, error)
+}
+
+var (
+	lastImportDesc = prometheus.NewDesc(
+		namespace+"_last_import_timestamp_seconds",
+		"Time the title dump was last retrieved.", nil, nil,
+	)
+	dumpEntriesDesc = prometheus.NewDesc(
+		namespace+"_dump_entries",
+		"Number of anime in the last imported dump.", nil, nil,
+	)
+	dumpTitlesDesc = prometheus.NewDesc(
+		namespace+"_dump_titles",
+		"Number of titles in the last imported dump.", nil, nil,
+	)
+	indexDocumentsDesc = prometheus.NewDesc(
+		namespace+"_index_documents",
+		"Number of anime documents in the search index.", nil, nil,
+	)
+	indexUpDesc = prometheus.NewDesc(
+		namespace+"_index_up",
+		"Whether the search index could be read during the last scrape.",
+		nil, nil,
+	)
+)
+
+// IndexCollector reads the import metadata and document count of the search
+// index on every scrape, so the gauges also reflect imports run by a separate
+// importer process.
+type IndexCollector struct {
+	source  IndexSource
+	timeout time.Duration
+}
+
+// NewIndexCollector creates an IndexCollector reading from source.
+func NewIndexCollector(source IndexSource) *IndexCollector {
+	return &IndexCollector{source: source, timeout: 5 * time.Second}
+}
+
+func (c *IndexCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastImportDesc
+	ch <- dumpEntriesDesc
+	ch <- dumpTitlesDesc
+	ch <- indexDocumentsDesc
+	ch <- indexUpDesc
+}
+
+func (c *IndexCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	up := 1.0
+	meta, err := c.source.GetMetadata(ctx)
+	if err != nil {
+		up = 0
+	} else if meta != nil {
+		ch <- prometheus.MustNewConstMetric(
+			lastImportDesc, prometheus.GaugeValue,
+			float64(meta.RetrievedAt.Unix()),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			dumpEntriesDesc, prometheus.GaugeValue, float64(meta.DumpEntries),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			dumpTitlesDesc, prometheus.GaugeValue, float64(meta.DumpTitles),
+		)
+	}
+
+	count, err := c.source.CountAnime(ctx)
+	if err != nil {
+		up = 0
+	} else {
+		ch <- prometheus.MustNewConstMetric(
+			indexDocumentsDesc, prometheus.GaugeValue, float64(count),
+		)
+	}
+
+	ch <- prometheus.MustNewConstMetric(indexUpDesc, prometheus.GaugeValue, up)
+}
+
+// Middleware records the count and latency of requests served by next, labelled
+// by the matched route pattern. It must wrap the ServeMux itself, as the
+// pattern is only known once the mux has routed the request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sw, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := prometheus.Labels{
+			"route":  route,
+			"method": r.Method,
+			"status": strconv.Itoa(sw.status),
+		}
+		HTTPRequests.With(labels).Inc()
+		HTTPDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusWriter records the status code written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer, which
+// the event stream relies on for flushing.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,103 @@
+// Package tracing sets up OpenTelemetry tracing, exporting the spans started
+// through the global tracer provider by all michiru packages.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"michiru/config"
+)
+
+// Setup installs a tracer provider exporting spans with cfg.TraceExporter,
+// and W3C trace context propagation. The returned function flushes any
+// buffered spans and must be called before exiting. If tracing is disabled,
+// spans are not recorded, but trace context is still propagated.
+func Setup(
+	ctx context.Context, cfg config.Config, service string,
+) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{}, propagation.Baggage{},
+		),
+	)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.TraceExporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		opts := make([]otlptracehttp.Option, 0, 1)
+		if cfg.TraceEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.TraceEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf(
+			"invalid trace exporter %q, must be none, otlp or stdout",
+			cfg.TraceExporter,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL, semconv.ServiceName(service),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(
+			sdktrace.ParentBased(
+				sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio),
+			),
+		),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a span for each request served by next, continuing the
+// trace of the client if it sent a traceparent header. Spans are named after
+// the pattern of the route in routes matching the request, which is looked up
+// before serving as next may replace the request passed to the mux.
+func Middleware(next http.Handler, routes *http.ServeMux) http.Handler {
+	return otelhttp.NewHandler(
+		next, "http.server",
+		otelhttp.WithSpanNameFormatter(
+			func(operation string, r *http.Request) string {
+				if _, pattern := routes.Handler(r); pattern != "" {
+					return pattern
+				}
+				return r.Method + " unmatched"
+			},
+		),
+	)
+}
+
+// Transport wraps next to start a client span for each outgoing request and
+// propagate its trace context.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(next)
+}
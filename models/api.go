@@ -1,8 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // API request params
@@ -11,14 +13,27 @@ type QueryParams struct {
 	Query  string
 	Limit  int
 	Offset int
+	Langs  []string
+	Types  []string
 }
 
 func (q *QueryParams) ToQueryString() url.Values {
-	return url.Values{
+	values := url.Values{
 		"query":  {q.Query},
 		"limit":  {strconv.Itoa(q.Limit)},
 		"offset": {strconv.Itoa(q.Offset)},
 	}
+	if len(q.Langs) > 0 {
+		values.Set("lang", strings.Join(q.Langs, ","))
+	}
+	if len(q.Types) > 0 {
+		values.Set("type", strings.Join(q.Types, ","))
+	}
+	return values
+}
+
+type BatchRequest struct {
+	Aids []json.Number `json:"aids"`
 }
 
 type AnimeSearchDocument struct {
@@ -28,6 +43,12 @@ type AnimeSearchDocument struct {
 	RankingScore    float64                `json:"_rankingScore,omitempty"`
 }
 
+type TitleSearchDocument struct {
+	TitleDocument
+	Formatted    TitleDocument `json:"_formatted"`
+	RankingScore float64       `json:"_rankingScore,omitempty"`
+}
+
 // JSON response structs
 
 type QueryResponse struct {
@@ -40,3 +61,72 @@ type PagingResponse struct {
 	Next  *string `json:"next,omitempty"`
 	Prev  *string `json:"prev,omitempty"`
 }
+
+type BatchResponse struct {
+	Anime   map[string]AnimeDocument `json:"anime"`
+	Unknown []string                 `json:"unknown"`
+}
+
+type Suggestion struct {
+	Aid          json.Number `json:"aid"`
+	MatchedTitle string      `json:"matchedTitle"`
+	Lang         string      `json:"lang"`
+	Type         string      `json:"type"`
+}
+
+type SuggestResponse struct {
+	Payload []Suggestion `json:"payload"`
+}
+
+// ReleaseInfo holds the details parsed from the file name of a release.
+type ReleaseInfo struct {
+	Title   string `json:"title"`
+	Season  int    `json:"season,omitempty"`
+	Episode int    `json:"episode,omitempty"`
+}
+
+type ResolveResponse struct {
+	Aid        json.Number `json:"aid"`
+	MainTitle  string      `json:"mainTitle"`
+	Confidence float64     `json:"confidence"`
+	Parsed     ReleaseInfo `json:"parsed"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type ImportRequest struct {
+	Force bool `json:"force"`
+}
+
+type ImportJobsResponse struct {
+	Payload []ImportJob `json:"payload"`
+}
+
+type ImportHistoryResponse struct {
+	Payload []ImportReport `json:"payload"`
+	Paging  PagingResponse `json:"paging"`
+}
+
+type TitleChangesResponse struct {
+	Payload []TitleChange   `json:"payload"`
+	Paging  *PagingResponse `json:"paging,omitempty"`
+}
+
+// Readiness check statuses
+const (
+	CheckOk     = "ok"
+	CheckFailed = "failed"
+)
+
+type HealthCheck struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
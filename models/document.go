@@ -1,13 +1,22 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
 	"time"
 )
 
+// TitleTypes lists the AniDB title types in order of importance.
+var TitleTypes = []string{"main", "official", "short", "syn", "kana", "card"}
+
 type AnimeDocument struct {
 	Aid              json.Number         `json:"aid"`
-	MainTitle        string              `json:"mainTitle"`
+	MainTitle        string              `json:"mainTitle,omitempty"`
+	MainTitleLang    string              `json:"mainTitleLang,omitempty"`
 	OfficialTitles   map[string][]string `json:"officialTitles,omitempty"`
 	ShortTitles      map[string][]string `json:"shortTitles,omitempty"`
 	SynonymousTitles map[string][]string `json:"synonymousTitles,omitempty"`
@@ -15,10 +24,186 @@ type AnimeDocument struct {
 	CardTitles       map[string][]string `json:"cardTitles,omitempty"`
 }
 
+// Hash returns a content hash of the document, used to detect changed anime
+// between imports.
+func (doc AnimeDocument) Hash() string {
+	// Maps are marshalled with sorted keys, so the encoding is deterministic
+	b, _ := json.Marshal(doc)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// titleMap returns the titles of the given type keyed by language.
+// Main titles are not stored in a map, so nil is returned for them.
+func (doc AnimeDocument) titleMap(titleType string) map[string][]string {
+	switch titleType {
+	case "official":
+		return doc.OfficialTitles
+	case "short":
+		return doc.ShortTitles
+	case "syn":
+		return doc.SynonymousTitles
+	case "kana":
+		return doc.KanaTitles
+	case "card":
+		return doc.CardTitles
+	}
+	return nil
+}
+
+// Titles flattens all titles of the anime into individual documents, ordered by
+// title type importance and then language.
+func (doc AnimeDocument) Titles() []TitleDocument {
+	titles := make([]TitleDocument, 0)
+	add := func(value, lang, titleType string) {
+		titles = append(
+			titles, TitleDocument{
+				Id:    fmt.Sprintf("%s-%d", doc.Aid, len(titles)),
+				Aid:   doc.Aid,
+				Title: value,
+				Lang:  lang,
+				Type:  titleType,
+			},
+		)
+	}
+
+	if doc.MainTitle != "" {
+		add(doc.MainTitle, doc.MainTitleLang, "main")
+	}
+	for _, titleType := range TitleTypes[1:] {
+		titleMap := doc.titleMap(titleType)
+
+		langs := make([]string, 0, len(titleMap))
+		for lang := range titleMap {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+
+		for _, lang := range langs {
+			for _, value := range titleMap[lang] {
+				add(value, lang, titleType)
+			}
+		}
+	}
+
+	return titles
+}
+
+// FilterTitles returns a copy of the document containing only titles in the
+// given languages and of the given types. An empty filter matches everything.
+// Title slices are copied, so the result can be modified independently.
+func (doc AnimeDocument) FilterTitles(langs []string, types []string) AnimeDocument {
+	filtered := AnimeDocument{Aid: doc.Aid}
+
+	if (len(types) == 0 || slices.Contains(types, "main")) &&
+		(len(langs) == 0 || slices.Contains(langs, doc.MainTitleLang)) {
+		filtered.MainTitle = doc.MainTitle
+		filtered.MainTitleLang = doc.MainTitleLang
+	}
+
+	filterMap := func(titleType string) map[string][]string {
+		if len(types) > 0 && !slices.Contains(types, titleType) {
+			return nil
+		}
+
+		titleMap := make(map[string][]string)
+		for lang, values := range doc.titleMap(titleType) {
+			if len(langs) == 0 || slices.Contains(langs, lang) {
+				titleMap[lang] = slices.Clone(values)
+			}
+		}
+		return titleMap
+	}
+
+	filtered.OfficialTitles = filterMap("official")
+	filtered.ShortTitles = filterMap("short")
+	filtered.SynonymousTitles = filterMap("syn")
+	filtered.KanaTitles = filterMap("kana")
+	filtered.CardTitles = filterMap("card")
+
+	return filtered
+}
+
+// SetTitle replaces the first title of the given type and language equal to
+// old with value.
+func (doc *AnimeDocument) SetTitle(
+	titleType string, lang string, old string, value string,
+) {
+	if titleType == "main" {
+		if doc.MainTitle == old {
+			doc.MainTitle = value
+		}
+		return
+	}
+
+	titleMap := doc.titleMap(titleType)
+	for i, title := range titleMap[lang] {
+		if title == old {
+			titleMap[lang][i] = value
+			return
+		}
+	}
+}
+
+// TitleDocument is a single title of an anime. Titles are also indexed
+// individually so that searches can be restricted by title language and type.
+type TitleDocument struct {
+	Id    string      `json:"id"`
+	Aid   json.Number `json:"aid"`
+	Title string      `json:"title"`
+	Lang  string      `json:"lang"`
+	Type  string      `json:"type"`
+}
+
+// AnimeHashDocument stores the content hash of an AnimeDocument from the last import.
+type AnimeHashDocument struct {
+	Aid  json.Number `json:"aid"`
+	Hash string      `json:"hash"`
+}
+
+// AnimeDiff holds the aids which changed between the previous import and a new dump.
+type AnimeDiff struct {
+	Added    []string
+	Modified []string
+	Removed  []string
+}
+
+// Title change kinds
+const (
+	TitleAdded       = "added"
+	TitleRemoved     = "removed"
+	MainTitleChanged = "main_changed"
+)
+
+// TitleChange records a title of an anime being added or removed, or its main
+// title changing, between two imports.
+type TitleChange struct {
+	Id    string      `json:"id"`
+	Aid   json.Number `json:"aid"`
+	Kind  string      `json:"kind"`
+	Title string      `json:"title"`
+	Lang  string      `json:"lang"`
+	Type  string      `json:"type"`
+	// The previous main title, only set for main title changes
+	Previous     string    `json:"previous,omitempty"`
+	PreviousLang string    `json:"previousLang,omitempty"`
+	ChangedAt    time.Time `json:"changedAt"`
+}
+
+// DumpValidators holds the HTTP cache validators of a retrieved title dump.
+type DumpValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
 type MetadataDocument struct {
 	Id          string    `json:"id"`
 	RetrievedAt time.Time `json:"retrievedAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 	DumpEntries int64     `json:"dumpEntries"`
 	DumpTitles  int64     `json:"dumpTitles"`
+	Added       int64     `json:"added"`
+	Modified    int64     `json:"modified"`
+	Removed     int64     `json:"removed"`
+	DumpValidators
 }
@@ -0,0 +1,135 @@
+package models
+
+import "time"
+
+// Import job states, in the order an import moves through them. Checking covers
+// setting up the search backend and the import interval check made before the
+// dump is fetched, while each anime is validated as it is parsed.
+const (
+	ImportQueued   = "queued"
+	ImportChecking = "checking"
+	ImportFetching = "fetching"
+	ImportParsing  = "parsing"
+	ImportIndexing = "indexing"
+	ImportDone     = "done"
+	ImportFailed   = "failed"
+)
+
+// Import job triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerAdmin    = "admin"
+	TriggerImporter = "importer"
+)
+
+type ImportJob struct {
+	Id      string `json:"id"`
+	State   string `json:"state"`
+	Trigger string `json:"trigger"`
+	// Force skips the import interval check and fetches the dump even if
+	// it has not been modified
+	Force      bool          `json:"force"`
+	Attempts   int           `json:"attempts"`
+	QueuedAt   time.Time     `json:"queuedAt"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+	Phases     []ImportPhase `json:"phases"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// ImportPhase records the timing of one state of an import job. The duration
+// is only set once the phase has ended.
+type ImportPhase struct {
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"startedAt"`
+	EndedAt    *time.Time `json:"endedAt,omitempty"`
+	DurationMs int64      `json:"durationMs"`
+}
+
+// Import report outcomes
+const (
+	OutcomeSucceeded   = "succeeded"
+	OutcomeNotModified = "not_modified"
+	OutcomeSkipped     = "skipped"
+	OutcomeFailed      = "failed"
+)
+
+// ImportReport records a single run of the import pipeline. Dump fields are
+// only set if the dump was fetched and parsed.
+type ImportReport struct {
+	Id          string     `json:"id"`
+	JobId       string     `json:"jobId"`
+	Trigger     string     `json:"trigger"`
+	StartedAt   time.Time  `json:"startedAt"`
+	EndedAt     time.Time  `json:"endedAt"`
+	SourceURL   string     `json:"sourceUrl"`
+	ByteSize    int64      `json:"byteSize"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+	DumpEntries int64      `json:"dumpEntries"`
+	DumpTitles  int64      `json:"dumpTitles"`
+	Added       int64      `json:"added"`
+	Modified    int64      `json:"modified"`
+	Removed     int64      `json:"removed"`
+	Outcome     string     `json:"outcome"`
+	Error       string     `json:"error,omitempty"`
+	// Deliveries of the webhook sent for this run, if any
+	Deliveries []WebhookDelivery `json:"deliveries,omitempty"`
+}
+
+// Webhook events
+const (
+	EventImport = "import"
+)
+
+// WebhookPayload is the body of the webhook sent after an import.
+type WebhookPayload struct {
+	Event    string            `json:"event"`
+	ReportId string            `json:"reportId"`
+	Outcome  string            `json:"outcome"`
+	Metadata *MetadataDocument `json:"metadata,omitempty"`
+	Added    []string          `json:"added"`
+	Changed  []string          `json:"changed"`
+	Removed  []string          `json:"removed"`
+	Error    string            `json:"error,omitempty"`
+	// When the payload was first sent, retries keep the same time
+	SentAt time.Time `json:"sentAt"`
+}
+
+// WebhookDelivery records the delivery of a webhook to a single target.
+type WebhookDelivery struct {
+	URL        string    `json:"url"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	SentAt     time.Time `json:"sentAt"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Import event types
+const (
+	EventState    = "state"
+	EventFetch    = "fetch"
+	EventValidate = "validate"
+	EventParse    = "parse"
+	EventTask     = "task"
+	EventSummary  = "summary"
+)
+
+// ImportEvent reports the progress of an import job. Only the fields relevant
+// to the event type are set.
+type ImportEvent struct {
+	Type  string    `json:"type"`
+	JobId string    `json:"jobId"`
+	Time  time.Time `json:"time"`
+	// New state of the job, for state events
+	State string `json:"state,omitempty"`
+	// Compressed bytes of the dump downloaded so far, for fetch events
+	BytesRead int64 `json:"bytesRead,omitempty"`
+	// Anime validated or parsed so far, for validate and parse events
+	Anime int64 `json:"anime,omitempty"`
+	// Meilisearch task, for task events
+	TaskUid    *int64 `json:"taskUid,omitempty"`
+	TaskType   string `json:"taskType,omitempty"`
+	TaskStatus string `json:"taskStatus,omitempty"`
+	// Report of the finished run, for summary events
+	Report *ImportReport `json:"report,omitempty"`
+}
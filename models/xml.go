@@ -34,6 +34,7 @@ func (anime AnimeXMLItem) ToDocument() AnimeDocument {
 		switch title.Type {
 		case "main":
 			doc.MainTitle = title.Value
+			doc.MainTitleLang = title.Language
 		case "official":
 			doc.OfficialTitles[title.Language] = append(
 				doc.OfficialTitles[title.Language], title.Value,